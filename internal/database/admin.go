@@ -3,16 +3,21 @@ package database
 import (
 	"errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+	"strings"
 )
 
-// AdminGetUsers retrieves all users from the database
-func (s *service) AdminGetUsers() ([]models.User, error) {
+// AdminGetUsers retrieves a page of users from the database
+func (s *service) AdminGetUsers(q pagination.Query) ([]models.User, *types.Meta, error) {
 	var users []models.User
-	if err := s.DB.Find(&users).Error; err != nil {
-		return nil, err
+	meta, err := pagination.Find(s.DB.Model(&models.User{}), q, &users)
+	if err != nil {
+		return nil, nil, err
 	}
-	return users, nil
+	return users, meta, nil
 }
 
 // AdminGetUser retrieves a single user by their ID
@@ -29,44 +34,56 @@ func (s *service) AdminGetUser(id uint) (*models.User, error) {
 
 // AdminDeleteUser deletes a user by ID
 func (s *service) AdminDeleteUser(id uint) error {
-	result := s.DB.Unscoped().Delete(&models.User{}, id)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
-	}
-	return nil
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := releaseUserCounters(tx, id); err != nil {
+			return err
+		}
+		result := tx.Unscoped().Delete(&models.User{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
 }
 
-// AdminUpdateUser updates an existing user's information
+// AdminUpdateUser updates an existing user's information. A changed email address has to
+// be verified again, like one the user changed themselves.
 func (s *service) AdminUpdateUser(user *models.User) error {
-	result := s.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{
-		"username": user.Username,
-		"email":    user.Email,
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "email").First(&existing, user.ID).Error; err != nil {
+			return err
+		}
+
+		columns := map[string]any{
+			"username": user.Username,
+			"email":    user.Email,
+		}
+		if !strings.EqualFold(user.Email, existing.Email) {
+			columns["email_verified_at"] = nil
+			columns["verification_sent_at"] = nil
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(columns).Error
 	})
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
-	}
-	return nil
 }
 
-// AdminGetBlogs retrieves all blogs along with their related data
-func (s *service) AdminGetBlogs() ([]models.Blog, error) {
+// AdminGetBlogs retrieves a page of blogs in any state with their tags, category and the relations named in include
+func (s *service) AdminGetBlogs(q pagination.Query, include []string) ([]models.Blog, *types.Meta, error) {
 	var blogs []models.Blog
-	if err := s.DB.Preload("User").Preload("Comments").Preload("Likes").Preload("Views").Find(&blogs).Error; err != nil {
-		return nil, err
+	meta, err := pagination.Find(s.DB.Model(&models.Blog{}), q, &blogs, blogListing(include))
+	if err != nil {
+		return nil, nil, err
 	}
-	return blogs, nil
+	return blogs, meta, nil
 }
 
 // AdminGetBlog retrieves a single blog by its ID along with related data
 func (s *service) AdminGetBlog(id uint) (*models.Blog, error) {
 	var blog models.Blog
-	if err := s.DB.Preload("User").Preload("Comments").Preload("Likes").Preload("Views").First(&blog).Error; err != nil {
+	if err := s.DB.Preload("User").Preload("Comments").Preload("Likes").Preload("Views").First(&blog, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -87,36 +104,24 @@ func (s *service) AdminDeleteBlog(id uint) error {
 	return nil
 }
 
-// AdminUpdateBlog updates a blog's information
-func (s *service) AdminUpdateBlog(blog *models.Blog) error {
-	result := s.DB.Model(&models.Blog{}).Where("id = ?", blog.ID).Updates(map[string]any{
-		"title":   blog.Title,
-		"content": blog.Content,
+// AdminUpdateBlog updates a blog's information, recording the edit by editorID as a revision.
+// It returns gorm.ErrRecordNotFound when the blog does not exist.
+func (s *service) AdminUpdateBlog(blog *models.Blog, editorID uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return updateBlogContent(tx, blog, models.BlogRevision{EditorID: &editorID})
 	})
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
-	}
-	return nil
 }
 
 // AdminDeleteComment deletes a comment by ID
 func (s *service) AdminDeleteComment(id uint) error {
-	result := s.DB.Delete(&models.Comment{}, id)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
-	}
-	return nil
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteComment(tx, id)
+	})
 }
 
-// AdminUpdateComment updates a comment's content
+// AdminUpdateComment updates a comment's content; tombstones cannot be edited
 func (s *service) AdminUpdateComment(id uint, content string) error {
-	result := s.DB.Model(&models.Comment{}).Where("id = ?", id).Update("content", content)
+	result := s.DB.Model(&models.Comment{}).Where("id = ? AND deleted_at IS NULL", id).Update("content", content)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -125,18 +130,20 @@ func (s *service) AdminUpdateComment(id uint, content string) error {
 	}
 	return nil
 }
-func (s *service) AdminGetComments() ([]models.Comment, error) {
+func (s *service) AdminGetComments(q pagination.Query) ([]models.Comment, *types.Meta, error) {
 	var comments []models.Comment
-	if err := s.DB.Find(&comments).Error; err != nil {
-		return nil, err // Return the error if the query fails
+	meta, err := pagination.Find(s.DB.Model(&models.Comment{}), q, &comments)
+	if err != nil {
+		return nil, nil, err // Return the error if the query fails
 	}
-	return comments, nil
+	return comments, meta, nil
 }
 
 type DashboardData struct {
-	TotalUsers    int64 `json:"total_users"`
-	TotalBlogs    int64 `json:"total_blogs"`
-	TotalComments int64 `json:"total_comments"`
+	TotalUsers      int64 `json:"total_users"`
+	TotalBlogs      int64 `json:"total_blogs"`
+	TotalComments   int64 `json:"total_comments"`
+	PendingComments int64 `json:"pending_comments"` // Comments awaiting moderation
 	// Add other metrics as needed
 }
 
@@ -154,8 +161,13 @@ func (s *service) GetAdminDashboardData() (DashboardData, error) {
 		return dashboardData, err
 	}
 
-	// Query to get the total number of comments
-	if err := s.DB.Model(&models.Comment{}).Count(&dashboardData.TotalComments).Error; err != nil {
+	// Query to get the total number of comments, leaving out tombstones
+	if err := s.DB.Model(&models.Comment{}).Where("deleted_at IS NULL").Count(&dashboardData.TotalComments).Error; err != nil {
+		return dashboardData, err
+	}
+
+	// Query to get the number of comments in the moderation queue
+	if err := s.DB.Model(&models.Comment{}).Where("deleted_at IS NULL AND status = ?", models.CommentStatusPending).Count(&dashboardData.PendingComments).Error; err != nil {
 		return dashboardData, err
 	}
 
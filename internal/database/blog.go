@@ -2,24 +2,57 @@ package database
 
 import (
 	"errors"
+	"log"
 	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// GetBlogs retrieves all blogs along with their related data
-func (s *service) GetBlogs() ([]models.Blog, error) {
+// BlogIncludes maps the ?include= values of blog listings to the relations they expand
+var BlogIncludes = map[string]string{
+	"comments": "Comments",
+	"likes":    "Likes",
+	"views":    "Views",
+}
+
+// BlogListSpec lists the sorts and filters supported by blog listings
+var BlogListSpec = pagination.Spec{
+	Table: "blogs",
+	Sorts: map[string]pagination.Sort{
+		"created_at":   {Expr: "blogs.created_at", Kind: pagination.Time},
+		"published_at": {Expr: "COALESCE(blogs.published_at, blogs.created_at)", Kind: pagination.Time},
+		"title":        {Expr: "blogs.title", Kind: pagination.String},
+		"likes":        {Expr: "blogs.likes_count", Kind: pagination.Int},
+		"views":        {Expr: "blogs.views_count", Kind: pagination.Int},
+		"comments":     {Expr: "blogs.comments_count", Kind: pagination.Int},
+	},
+	DefaultSort: "created_at",
+	Filters: []pagination.Filter{
+		{Param: "author_id", Column: "blogs.user_id", Kind: pagination.Int},
+		{Param: "category_id", Column: "blogs.category_id", Kind: pagination.Int},
+		{Param: "status", Column: "blogs.status", Kind: pagination.String},
+	},
+}
+
+// GetBlogs retrieves a page of the published blogs, plus any unpublished ones owned by viewerID,
+// with their tags, category and the relations named in include
+func (s *service) GetBlogs(viewerID uint, q pagination.Query, include []string) ([]models.Blog, *types.Meta, error) {
 	var blogs []models.Blog
-	if err := s.DB.Preload("User").Preload("Comments").Preload("Likes").Preload("Views").Find(&blogs).Error; err != nil {
-		return nil, err
+	query := s.DB.Model(&models.Blog{}).Scopes(visibleBlogs(viewerID))
+	meta, err := pagination.Find(query, q, &blogs, blogListing(include))
+	if err != nil {
+		return nil, nil, err
 	}
-	return blogs, nil
+	return blogs, meta, nil
 }
 
 // GetBlog fetches a single blog by its ID along with its related data
 func (s *service) GetBlog(id uint) (*models.Blog, error) {
 	var blog models.Blog
-	if err := s.DB.Preload("User").Preload("Comments").Preload("Likes").First(&blog, id).Error; err != nil {
+	if err := s.DB.Preload("User").Preload("Comments", "status = ?", models.CommentStatusApproved).Preload("Likes").Preload("Tags").Preload("Category").First(&blog, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil // Return nil when the blog is not found
 		}
@@ -28,9 +61,29 @@ func (s *service) GetBlog(id uint) (*models.Blog, error) {
 	return &blog, nil
 }
 
-// CreateBlog inserts a new blog into the database and returns it
+// CreateBlog inserts a new blog with a unique slug derived from its title and returns it
 func (s *service) CreateBlog(blog *models.Blog) (*models.Blog, error) {
-	if err := s.DB.Create(blog).Error; err != nil {
+	if err := renderBlogContent(blog); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		slug, err := allocateBlogSlug(tx, blog.Title, 0)
+		if err != nil {
+			return err
+		}
+		blog.Slug = slug
+
+		if len(blog.Tags) > 0 {
+			if blog.Tags, err = resolveTags(tx, tagNames(blog.Tags)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit("Tags.*").Create(blog).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, blog, models.BlogRevision{EditorID: &blog.UserID})
+	})
+	if err != nil {
 		return nil, err
 	}
 	return blog, nil
@@ -48,17 +101,93 @@ func (s *service) DeleteBlog(id uint) error {
 	return nil
 }
 
-// UpdateBlog modifies an existing blog's fields safely
-func (s *service) UpdateBlog(blog *models.Blog) error {
+// BlogUpdate holds the optional parts of a blog update
+type BlogUpdate struct {
+	Tags        []string // Replaces the tags when not nil, creating tags that do not exist yet
+	SetCategory bool     // Moves the blog to CategoryID, or out of any category when it is nil
+	CategoryID  *uint
+}
+
+// UpdateBlog modifies an existing blog's fields safely, moving it to a new slug when the title
+// changes and recording the edit by editorID as a revision. The tags and category in update
+// change in the same transaction, and are set on blog.
+func (s *service) UpdateBlog(blog *models.Blog, editorID uint, update BlogUpdate) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateBlogContent(tx, blog, models.BlogRevision{EditorID: &editorID}); err != nil {
+			return err
+		}
+		if update.Tags != nil {
+			tags, err := setBlogTags(tx, blog.ID, update.Tags)
+			if err != nil {
+				return err
+			}
+			blog.Tags = tags
+		}
+		if update.SetCategory {
+			if err := tx.Model(&models.Blog{}).Where("id = ?", blog.ID).Update("category_id", update.CategoryID).Error; err != nil {
+				return err
+			}
+			blog.CategoryID, blog.Category = update.CategoryID, nil
+		}
+		return nil
+	})
+}
+
+// SetBlogStatus stores the lifecycle fields of a blog
+func (s *service) SetBlogStatus(blog *models.Blog) error {
 	result := s.DB.Model(&models.Blog{}).Where("id = ?", blog.ID).Updates(map[string]any{
-		"title":   blog.Title,
-		"content": blog.Content,
+		"status":       blog.Status,
+		"published_at": blog.PublishedAt,
+		"scheduled_at": blog.ScheduledAt,
 	})
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound // Return specific error when no rows are updated
+		return gorm.ErrRecordNotFound
 	}
 	return nil
 }
+
+// PublishScheduledBlogs publishes every scheduled blog whose time has come
+func (s *service) PublishScheduledBlogs(now time.Time) (int64, error) {
+	result := s.DB.Model(&models.Blog{}).
+		Where("status = ? AND scheduled_at <= ?", models.BlogStatusScheduled, now).
+		Updates(map[string]any{
+			"status":       models.BlogStatusPublished,
+			"published_at": gorm.Expr("scheduled_at"),
+			"scheduled_at": nil,
+		})
+	if result.Error != nil {
+		log.Printf("[DATABASE] Error publishing scheduled blogs: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// visibleBlogs limits a blog query to published blogs and those owned by viewerID
+func visibleBlogs(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("blogs.status = ? OR blogs.user_id = ?", models.BlogStatusPublished, viewerID)
+	}
+}
+
+// blogListing loads what a blog listing returns besides the blogs and their counters: the
+// tags and category, plus the relations named in include, see BlogIncludes. Only approved
+// comments are included.
+func blogListing(include []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Preload("Tags").Preload("Category")
+		for _, name := range include {
+			relation, ok := BlogIncludes[name]
+			switch {
+			case !ok:
+			case relation == "Comments":
+				db = db.Preload(relation, "status = ?", models.CommentStatusApproved)
+			default:
+				db = db.Preload(relation)
+			}
+		}
+		return db
+	}
+}
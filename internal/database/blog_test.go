@@ -0,0 +1,116 @@
+package database
+
+import (
+	"fmt"
+	"obs/internal/models"
+	"obs/internal/pagination"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Size of the listing benchmark's data set: every blog is liked and viewed by every
+// user and gets a few comments from each
+const (
+	benchBlogs           = 200
+	benchUsers           = 25
+	benchCommentsPerUser = 2
+)
+
+// seedBlogListing fills an empty database with blogs and their likes, comments and views,
+// then counts them into the blog counters
+func seedBlogListing(tb testing.TB, s *service) {
+	tb.Helper()
+
+	var count int64
+	if err := s.DB.Model(&models.Blog{}).Count(&count).Error; err != nil {
+		tb.Fatal(err)
+	}
+	if count >= benchBlogs {
+		return
+	}
+
+	users := make([]models.User, benchUsers)
+	for i := range users {
+		users[i] = models.User{Username: fmt.Sprintf("reader%d", i), Email: fmt.Sprintf("reader%d@example.com", i), Password: "x"}
+	}
+	if err := s.DB.CreateInBatches(&users, 100).Error; err != nil {
+		tb.Fatal(err)
+	}
+
+	blogs := make([]models.Blog, benchBlogs)
+	for i := range blogs {
+		blogs[i] = models.Blog{
+			Title:   fmt.Sprintf("Benchmark blog %d", i),
+			Content: "Some content for the listing benchmark",
+			UserID:  users[i%benchUsers].ID,
+			Author:  users[i%benchUsers].Username,
+			Slug:    fmt.Sprintf("benchmark-blog-%d", i),
+			Status:  models.BlogStatusPublished,
+		}
+	}
+	if err := s.DB.Omit("Tags").CreateInBatches(&blogs, 100).Error; err != nil {
+		tb.Fatal(err)
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO likes (user_id, blog_id, created_at) SELECT users.id, blogs.id, NOW() FROM users CROSS JOIN blogs`).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec(`INSERT INTO views (user_id, blog_id, created_at) SELECT users.id, blogs.id, NOW() FROM users CROSS JOIN blogs`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO comments (content, author, user_id, blog_id, status, created_at)
+			SELECT 'Comment ' || n, users.username, users.id, blogs.id, ?, NOW()
+			FROM users CROSS JOIN blogs CROSS JOIN generate_series(1, ?) AS n`,
+			models.CommentStatusApproved, benchCommentsPerUser).Error
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := s.RecountCounters(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// BenchmarkGetBlogs compares a page of the blog listing loaded the old way, preloading
+// every like, comment and view to count them, with the counter columns, and with the
+// counters plus ?include= expanding the same rows
+func BenchmarkGetBlogs(b *testing.B) {
+	s := testService(b)
+	seedBlogListing(b, s)
+	q := pagination.New(BlogListSpec, pagination.DefaultLimit)
+
+	b.Run("preload", func(b *testing.B) {
+		for range b.N {
+			var blogs []models.Blog
+			query := s.DB.Model(&models.Blog{}).Scopes(visibleBlogs(0))
+			_, err := pagination.Find(query, q, &blogs, func(db *gorm.DB) *gorm.DB {
+				return db.Preload("User").Preload("Comments").Preload("Likes").Preload("Views").Preload("Tags").Preload("Category")
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("counters", func(b *testing.B) {
+		for range b.N {
+			if _, _, err := s.GetBlogs(0, q, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("include", func(b *testing.B) {
+		include := []string{"comments", "likes", "views"}
+		for range b.N {
+			if _, _, err := s.GetBlogs(0, q, include); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"errors"
+	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCategoryInUse is returned when deleting a category that still has subcategories
+	ErrCategoryInUse = errors.New("category has subcategories")
+	// ErrCategoryCycle is returned when a category would become its own ancestor
+	ErrCategoryCycle = errors.New("category cannot be nested under itself")
+)
+
+// GetCategories lists every category ordered by name
+func (s *service) GetCategories() ([]models.Category, error) {
+	var categories []models.Category
+	if err := s.DB.Order("name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// GetCategory fetches a category by ID
+func (s *service) GetCategory(id uint) (*models.Category, error) {
+	var category models.Category
+	if err := s.DB.First(&category, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetCategoryBySlug fetches a category by its slug
+func (s *service) GetCategoryBySlug(slug string) (*models.Category, error) {
+	var category models.Category
+	if err := s.DB.Where("slug = ?", slug).First(&category).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetBlogsByCategory retrieves a page of the blogs viewerID may see in a category or any of its subcategories
+func (s *service) GetBlogsByCategory(categoryID uint, viewerID uint, q pagination.Query, include []string) ([]models.Blog, *types.Meta, error) {
+	var blogs []models.Blog
+	query := s.DB.Model(&models.Blog{}).
+		Where(`blogs.category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE id = ?
+				UNION ALL
+				SELECT categories.id FROM categories JOIN tree ON categories.parent_id = tree.id
+			)
+			SELECT id FROM tree)`, categoryID).
+		Scopes(visibleBlogs(viewerID))
+	meta, err := pagination.Find(query, q, &blogs, blogListing(include))
+	if err != nil {
+		return nil, nil, err
+	}
+	return blogs, meta, nil
+}
+
+// CreateCategory inserts a new category
+func (s *service) CreateCategory(category *models.Category) error {
+	return s.DB.Create(category).Error
+}
+
+// UpdateCategory updates a category's name, slug, description and parent
+func (s *service) UpdateCategory(category *models.Category) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if category.ParentID != nil {
+			// Walk up from the new parent to make sure the category is not among its ancestors
+			var ancestors int64
+			err := tx.Raw(`
+				WITH RECURSIVE ancestors AS (
+					SELECT id, parent_id FROM categories WHERE id = ?
+					UNION ALL
+					SELECT categories.id, categories.parent_id FROM categories JOIN ancestors ON categories.id = ancestors.parent_id
+				)
+				SELECT COUNT(*) FROM ancestors WHERE id = ?`, *category.ParentID, category.ID).Scan(&ancestors).Error
+			if err != nil {
+				return err
+			}
+			if ancestors > 0 {
+				return ErrCategoryCycle
+			}
+		}
+
+		result := tx.Model(&models.Category{}).Where("id = ?", category.ID).Updates(map[string]any{
+			"name":        category.Name,
+			"slug":        category.Slug,
+			"description": category.Description,
+			"parent_id":   category.ParentID,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteCategory removes a category without subcategories; its blogs become uncategorized.
+// They are moved out explicitly, as databases created before the foreign key cleared
+// itself still refuse to delete a category in use.
+func (s *service) DeleteCategory(id uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrCategoryInUse
+		}
+
+		if err := tx.Model(&models.Blog{}).Where("category_id = ?", id).Update("category_id", nil).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.Category{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
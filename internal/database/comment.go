@@ -2,18 +2,175 @@ package database
 
 import (
 	"errors"
+	"log"
 	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// GetComments retrieves all comments for a blog with user info
-func (s *service) GetComments(blogID uint) ([]models.Comment, error) {
+// CommentListSpec lists the sorts and filters supported by comment listings
+var CommentListSpec = pagination.Spec{
+	Table: "comments",
+	Sorts: map[string]pagination.Sort{
+		"created_at": {Expr: "comments.created_at", Kind: pagination.Time},
+	},
+	DefaultSort: "created_at",
+	Filters: []pagination.Filter{
+		{Param: "author_id", Column: "comments.user_id", Kind: pagination.Int},
+		{Param: "blog_id", Column: "comments.blog_id", Kind: pagination.Int},
+	},
+}
+
+// ReplyListSpec lists the sorts supported by the replies of a comment, which read
+// oldest first like a conversation
+var ReplyListSpec = pagination.Spec{
+	Table: "comments",
+	Sorts: map[string]pagination.Sort{
+		"created_at": {Expr: "comments.created_at", Kind: pagination.Time},
+	},
+	DefaultSort: "created_at",
+	Ascending:   true,
+}
+
+// CommentNode is a comment in a thread with the first page of its replies. NextCursor
+// continues the replies through the replies listing when there are more.
+type CommentNode struct {
+	models.Comment
+	Replies    []*CommentNode `json:"replies"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// visibleComments limits a comment query to approved comments and those written by viewerID
+func visibleComments(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("comments.status = ? OR comments.user_id = ?", models.CommentStatusApproved, viewerID)
+	}
+}
+
+// GetComments retrieves a page of the comments for a blog visible to viewerID with user
+// info, leaving out tombstones
+func (s *service) GetComments(blogID, viewerID uint, q pagination.Query) ([]models.Comment, *types.Meta, error) {
+	var comments []models.Comment
+	query := s.DB.Model(&models.Comment{}).Where("comments.blog_id = ? AND comments.deleted_at IS NULL", blogID).Scopes(visibleComments(viewerID))
+	meta, err := pagination.Find(query, q, &comments, func(db *gorm.DB) *gorm.DB {
+		return db.Preload("User")
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return comments, meta, nil
+}
+
+// GetCommentTree retrieves a page of the top-level comments of a blog, each with depth
+// levels of replies, at most replies per comment. Only comments visible to viewerID are
+// included, along with their replies.
+func (s *service) GetCommentTree(blogID, viewerID uint, q pagination.Query, depth, replies int) ([]*CommentNode, *types.Meta, error) {
+	var comments []models.Comment
+	query := s.DB.Model(&models.Comment{}).Where("comments.blog_id = ? AND comments.parent_id IS NULL", blogID).Scopes(visibleComments(viewerID))
+	meta, err := pagination.Find(query, q, &comments)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := s.loadReplies(comments, viewerID, depth, replies)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodes, meta, nil
+}
+
+// GetCommentReplies retrieves a page of the direct replies to a comment visible to
+// viewerID, each with depth further levels of replies, at most replies per comment
+func (s *service) GetCommentReplies(parentID, viewerID uint, q pagination.Query, depth, replies int) ([]*CommentNode, *types.Meta, error) {
 	var comments []models.Comment
-	if err := s.DB.Preload("User").Where("blog_id = ?", blogID).Find(&comments).Error; err != nil {
+	query := s.DB.Model(&models.Comment{}).Where("comments.parent_id = ?", parentID).Scopes(visibleComments(viewerID))
+	meta, err := pagination.Find(query, q, &comments)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := s.loadReplies(comments, viewerID, depth, replies)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodes, meta, nil
+}
+
+// GetCommentThread retrieves a comment with depth levels of the replies visible to
+// viewerID, at most replies per comment. Callers check the comment itself is visible.
+func (s *service) GetCommentThread(id, viewerID uint, depth, replies int) (*CommentNode, error) {
+	var comment models.Comment
+	if err := s.DB.First(&comment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
 		return nil, err
 	}
-	return comments, nil
+	nodes, err := s.loadReplies([]models.Comment{comment}, viewerID, depth, replies)
+	if err != nil {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// loadReplies builds the nodes of comments and fills in depth levels of their replies
+// visible to viewerID, the first limit replies of each comment, with one query per level
+func (s *service) loadReplies(comments []models.Comment, viewerID uint, depth, limit int) ([]*CommentNode, error) {
+	roots := make([]*CommentNode, len(comments))
+	for i := range comments {
+		roots[i] = &CommentNode{Comment: comments[i], Replies: []*CommentNode{}}
+	}
+
+	cursors := pagination.New(ReplyListSpec, limit)
+	level := roots
+	for ; depth > 0 && len(level) > 0; depth-- {
+		parents := make(map[uint]*CommentNode)
+		var ids []uint
+		for _, node := range level {
+			if node.RepliesCount > 0 {
+				parents[node.ID] = node
+				ids = append(ids, node.ID)
+			}
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		// One row past the limit tells whether a comment has more replies
+		var rows []struct {
+			models.Comment
+			Position int
+		}
+		err := s.DB.Raw(`
+			SELECT * FROM (
+				SELECT comments.*, ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY created_at, id) AS position
+				FROM comments WHERE parent_id IN ? AND (status = ? OR user_id = ?)
+			) replies
+			WHERE position <= ?
+			ORDER BY parent_id, position`, ids, models.CommentStatusApproved, viewerID, limit+1).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+
+		var next []*CommentNode
+		for _, row := range rows {
+			parent := parents[*row.ParentID]
+			if row.Position > limit {
+				last := parent.Replies[len(parent.Replies)-1]
+				if parent.NextCursor, err = cursors.CursorAfter(last.CreatedAt, last.ID); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			node := &CommentNode{Comment: row.Comment, Replies: []*CommentNode{}}
+			parent.Replies = append(parent.Replies, node)
+			next = append(next, node)
+		}
+		level = next
+	}
+	return roots, nil
 }
 
 // GetComment fetches a single comment by its ID
@@ -28,31 +185,139 @@ func (s *service) GetComment(id uint) (*models.Comment, error) {
 	return &comment, nil
 }
 
-// CreateComment inserts a new comment into the database
-func (s *service) CreateComment(comment *models.Comment) error {
-	return s.DB.Create(comment).Error
+// CreateComment inserts a new comment into the database and counts it on its parent when
+// it is a reply. Approved comments are counted on their blog; comments held back by
+// moderation get a decision recording reason instead.
+func (s *service) CreateComment(comment *models.Comment, reason string) error {
+	if comment.Status == "" {
+		comment.Status = models.CommentStatusApproved
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		if comment.ParentID != nil {
+			if err := adjustCounter(tx, &models.Comment{}, *comment.ParentID, "replies_count", 1); err != nil {
+				return err
+			}
+		}
+		if !comment.IsApproved() {
+			return tx.Create(&models.CommentDecision{CommentID: comment.ID, Status: comment.Status, Reason: reason}).Error
+		}
+		return adjustCounter(tx, &models.Blog{}, comment.BlogID, "comments_count", 1)
+	})
 }
 
-// UpdateComment updates only the content of a comment
-func (s *service) UpdateComment(id uint, userID uint, content string) error {
-	result := s.DB.Model(&models.Comment{}).Where("id = ? AND user_id = ?", id, userID).Update("content", content)
-	if result.Error != nil {
-		return result.Error
+// UpdateComment updates only the content of a comment; tombstones cannot be edited. A
+// non-empty status different from the comment's moves it there as moderation would,
+// recording reason with the decision and keeping its blog's counter in step.
+func (s *service) UpdateComment(id uint, content, status, reason string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var comment models.Comment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("deleted_at IS NULL").First(&comment, id).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Comment{}).Where("id = ?", id).Update("content", content).Error; err != nil {
+			return err
+		}
+		if status == "" || status == comment.Status {
+			return nil
+		}
+		return setCommentStatus(tx, &comment, status, reason, nil)
+	})
+}
+
+// DeleteComment deletes a comment; callers are expected to have checked ownership
+func (s *service) DeleteComment(id uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteComment(tx, id)
+	})
+}
+
+// deleteComment deletes a comment and uncounts it on its blog if it was approved. A
+// comment with replies becomes a tombstone instead, keeping the replies in place; a
+// tombstone left without replies is deleted in turn.
+func deleteComment(tx *gorm.DB, id uint) error {
+	var comment models.Comment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&comment, id).Error; err != nil {
+		return err
 	}
-	if result.RowsAffected == 0 {
+	if comment.IsDeleted() {
 		return gorm.ErrRecordNotFound
 	}
-	return nil
+	if comment.IsApproved() {
+		if err := adjustCounter(tx, &models.Blog{}, comment.BlogID, "comments_count", -1); err != nil {
+			return err
+		}
+	}
+
+	if comment.RepliesCount > 0 {
+		return tx.Model(&models.Comment{}).Where("id = ?", comment.ID).Updates(map[string]any{
+			"content":    models.CommentTombstone,
+			"author":     models.CommentTombstone,
+			"user_id":    nil,
+			"deleted_at": time.Now(),
+		}).Error
+	}
+
+	for {
+		if err := tx.Delete(&models.Comment{}, comment.ID).Error; err != nil {
+			return err
+		}
+		if comment.ParentID == nil {
+			return nil
+		}
+
+		// Uncount the reply on its parent, and prune the parent if it was a tombstone
+		// kept only for this reply
+		var parent models.Comment
+		result := tx.Model(&parent).
+			Clauses(clause.Returning{}).
+			Where("id = ?", *comment.ParentID).
+			UpdateColumn("replies_count", gorm.Expr("GREATEST(replies_count - 1, 0)"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || !parent.IsDeleted() || parent.RepliesCount > 0 {
+			return nil
+		}
+		comment = parent
+	}
 }
 
-// DeleteComment ensures only the comment owner can delete it
-func (s *service) DeleteComment(id uint, userID uint) error {
-	result := s.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Comment{})
-	if result.Error != nil {
-		return result.Error
+// deleteUserComments deletes the comments of a user who is being deleted, deepest first so
+// replies are gone before their parents are looked at. Comments others replied to become
+// tombstones.
+func deleteUserComments(tx *gorm.DB, userID uint) error {
+	var ids []uint
+	if err := tx.Model(&models.Comment{}).Where("user_id = ?", userID).Order("depth DESC, id").Pluck("id", &ids).Error; err != nil {
+		return err
 	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+	for _, id := range ids {
+		// An earlier deletion may have pruned it already
+		if err := deleteComment(tx, id); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
 	}
 	return nil
 }
+
+// migrateCommentAuthors makes deleting a user set the author of their remaining comments
+// to NULL. The constraint used to cascade, and AutoMigrate does not change existing
+// constraints.
+func (s *service) migrateCommentAuthors() error {
+	err := s.DB.Exec(`
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_users_comments' AND confdeltype = 'c') THEN
+				ALTER TABLE comments DROP CONSTRAINT fk_users_comments;
+				ALTER TABLE comments ADD CONSTRAINT fk_users_comments
+					FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+			END IF;
+		END $$`).Error
+	if err != nil {
+		log.Printf("[DATABASE] Error migrating comment authors: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// CounterRepairs reports how many rows RecountCounters had to correct
+type CounterRepairs struct {
+	Blogs    int64 `json:"blogs"`
+	Users    int64 `json:"users"`
+	Comments int64 `json:"comments"`
+}
+
+// RecountCounters recomputes the denormalized engagement counters from the rows they count
+// and fixes the ones that drifted, e.g. after manual edits to the database. Tombstones of
+// deleted comments count as replies but not towards a blog's comments, and neither do
+// comments that are not approved.
+func (s *service) RecountCounters() (CounterRepairs, error) {
+	var repairs CounterRepairs
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`
+			UPDATE blogs SET likes_count = c.likes, comments_count = c.comments, views_count = c.views
+			FROM (
+				SELECT b.id,
+					(SELECT COUNT(*) FROM likes WHERE likes.blog_id = b.id) AS likes,
+					(SELECT COUNT(*) FROM comments WHERE comments.blog_id = b.id AND comments.deleted_at IS NULL AND comments.status = 'approved') AS comments,
+					(SELECT COUNT(*) FROM views WHERE views.blog_id = b.id) AS views
+				FROM blogs b
+			) c
+			WHERE blogs.id = c.id
+				AND (blogs.likes_count, blogs.comments_count, blogs.views_count) IS DISTINCT FROM (c.likes, c.comments, c.views)`)
+		if result.Error != nil {
+			return result.Error
+		}
+		repairs.Blogs = result.RowsAffected
+
+		result = tx.Exec(`
+			UPDATE users SET followers_count = c.followers, following_count = c.following
+			FROM (
+				SELECT u.id,
+					(SELECT COUNT(*) FROM follows WHERE follows.followed_id = u.id) AS followers,
+					(SELECT COUNT(*) FROM follows WHERE follows.follower_id = u.id) AS following
+				FROM users u
+			) c
+			WHERE users.id = c.id
+				AND (users.followers_count, users.following_count) IS DISTINCT FROM (c.followers, c.following)`)
+		if result.Error != nil {
+			return result.Error
+		}
+		repairs.Users = result.RowsAffected
+
+		result = tx.Exec(`
+			UPDATE comments SET replies_count = c.replies
+			FROM (
+				SELECT p.id, (SELECT COUNT(*) FROM comments r WHERE r.parent_id = p.id) AS replies
+				FROM comments p
+			) c
+			WHERE comments.id = c.id AND comments.replies_count IS DISTINCT FROM c.replies`)
+		if result.Error != nil {
+			return result.Error
+		}
+		repairs.Comments = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		log.Printf("[DATABASE] Error recounting counters: %v", err)
+		return repairs, err
+	}
+
+	log.Printf("[DATABASE] Recount repaired %d blogs, %d users and %d comments", repairs.Blogs, repairs.Users, repairs.Comments)
+	return repairs, nil
+}
+
+// adjustCounter adds delta to a counter column of the row with the given ID. Counters
+// never go below zero, so a missed increment cannot make them negative.
+func adjustCounter(tx *gorm.DB, model any, id uint, column string, delta int) error {
+	return tx.Model(model).Where("id = ?", id).UpdateColumn(column, gorm.Expr("GREATEST("+column+" + ?, 0)", delta)).Error
+}
+
+// releaseUserCounters decrements the counters the rows of a user contribute to on other
+// blogs and users. It must run before the user is deleted, as the rows go with it. Their
+// comments are deleted here so replies from others are kept under tombstones.
+func releaseUserCounters(tx *gorm.DB, userID uint) error {
+	if err := deleteUserComments(tx, userID); err != nil {
+		return err
+	}
+
+	statements := []string{
+		`UPDATE blogs SET likes_count = GREATEST(likes_count - 1, 0) WHERE id IN (SELECT blog_id FROM likes WHERE user_id = @user)`,
+		`UPDATE blogs SET views_count = GREATEST(views_count - 1, 0) WHERE id IN (SELECT blog_id FROM views WHERE user_id = @user)`,
+		`UPDATE users SET followers_count = GREATEST(followers_count - 1, 0) WHERE id IN (SELECT followed_id FROM follows WHERE follower_id = @user)`,
+		`UPDATE users SET following_count = GREATEST(following_count - 1, 0) WHERE id IN (SELECT follower_id FROM follows WHERE followed_id = @user)`,
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement, map[string]any{"user": userID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
 	"os"
 	"strconv"
 	"time"
@@ -24,25 +26,126 @@ type Service interface {
 	GetUserByEmail(email string) (*models.User, error)
 	CreateUser(user *models.User) error
 	GetUser(id uint) (*models.User, error)
-	GetUsers() ([]models.User, error)
+	GetUsers(q pagination.Query) ([]models.User, *types.Meta, error)
 	DeleteUser(id uint) error
 	UpdateUser(user *models.User) error
 	FollowUser(followerID, followedID uint) error
 	UnfollowUser(followerID, followedID uint) error
 	IsFollowing(followerID, followedID uint) (bool, error)
+	MarkEmailVerified(userID uint, email string) error
+	SetVerificationSentAt(userID uint, sentAt time.Time) error
+
+	// Session Methods
+	CreateSession(session *models.Session, token *models.RefreshToken) error
+	GetSession(id uint) (*models.Session, error)
+	GetRefreshToken(tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(old *models.RefreshToken, next *models.RefreshToken) error
+	RevokeSession(id uint) error
+	GetUserSessions(userID uint) ([]models.Session, error)
+	RevokeUserSession(userID, sessionID uint) error
+	RevokeAllSessions(userID, exceptID uint) (int64, error)
+	TouchSession(id uint, ip string) error
+
+	// Personal Access Token Methods
+	CreatePersonalAccessToken(token *models.PersonalAccessToken) error
+	GetPersonalAccessTokens(userID uint) ([]models.PersonalAccessToken, error)
+	GetPersonalAccessTokenByHash(tokenHash string) (*models.PersonalAccessToken, error)
+	RevokePersonalAccessToken(userID, tokenID uint) error
+	TouchPersonalAccessToken(id uint) error
+
+	// Password Reset Methods
+	CreatePasswordReset(reset *models.PasswordReset) error
+	ResetPassword(tokenHash, hashedPassword string) (uint, error)
+
+	// Two-Factor Methods
+	SetTOTPSecret(userID uint, secret string) error
+	EnableTwoFactor(userID uint, step int64, codeHashes []string) error
+	DisableTwoFactor(userID uint) error
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	CountRecoveryCodes(userID uint) (int64, error)
+	UseTOTPStep(userID uint, step int64) (bool, error)
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+
+	// Identity Methods
+	GetIdentity(provider, subject string) (*models.Identity, error)
+	GetUserIdentities(userID uint) ([]models.Identity, error)
+	CreateIdentity(identity *models.Identity) error
+	CreateUserWithIdentity(user *models.User, identity *models.Identity) error
+	DeleteIdentity(userID uint, provider string) error
+
+	// Tag and Category Methods
+	GetTags(prefix string, limit int) ([]models.Tag, error)
+	GetTag(id uint) (*models.Tag, error)
+	GetBlogsByTag(slug string, viewerID uint, q pagination.Query, include []string) ([]models.Blog, *types.Meta, error)
+	RenameTag(id uint, name string) (*models.Tag, error)
+	MergeTags(sourceID, targetID uint) error
+	GetCategories() ([]models.Category, error)
+	GetCategory(id uint) (*models.Category, error)
+	GetCategoryBySlug(slug string) (*models.Category, error)
+	GetBlogsByCategory(categoryID uint, viewerID uint, q pagination.Query, include []string) ([]models.Blog, *types.Meta, error)
+	CreateCategory(category *models.Category) error
+	UpdateCategory(category *models.Category) error
+	DeleteCategory(id uint) error
+
+	// Revision Methods
+	GetBlogRevisions(blogID uint, q pagination.Query) ([]models.BlogRevision, *types.Meta, error)
+	GetBlogRevision(blogID uint, number int) (*models.BlogRevision, error)
+	GetLatestBlogRevision(blogID uint) (*models.BlogRevision, error)
+	RestoreBlogRevision(blog *models.Blog, revision *models.BlogRevision, editorID uint) error
+
+	// Media Methods
+	CreateMedia(media *models.Media, quota int64) error
+	GetMedia(id uint) (*models.Media, error)
+	GetUserMedia(userID uint, q pagination.Query) ([]models.Media, *types.Meta, error)
+	GetUserMediaKeys(userID uint) ([]string, error)
+	GetBlogMediaKeys(blogID uint) ([]string, error)
+	GetMediaUsage(userID uint) (int64, error)
+	DeleteMedia(id uint) error
+	ClaimPendingMedia(limit int, staleBefore time.Time) ([]models.Media, error)
+	CompleteMedia(media *models.Media, url string, urls models.Renditions) ([]models.Media, error)
+	FailMedia(id uint, attempt int, reason string) error
+	ClearBlogCover(blogID uint) ([]models.Media, error)
+
+	// Search Methods
+	SearchBlogs(filters SearchFilters) ([]BlogSearchResult, string, error)
+	SearchComments(filters SearchFilters) ([]CommentSearchResult, string, error)
+
+	// Role Methods
+	GetRolePermissions() ([]models.RolePermission, error)
+	RoleHasPermission(role, permission string) (bool, error)
+	GrantPermission(role, permission string) error
+	RevokePermission(role, permission string) error
+	SetUserRole(userID uint, role string) error
+	BanUser(userID uint, reason string) error
+	UnbanUser(userID uint) error
+
+	// Login Attempt Methods
+	GetLoginAttempt(key string) (*models.LoginAttempt, error)
+	UpdateLoginAttempt(key string, update func(attempt *models.LoginAttempt)) (*models.LoginAttempt, error)
+	DeleteLoginAttempt(key string) error
+	GetLoginAttempts(minFailures int, since time.Time) ([]models.LoginAttempt, error)
+	DeleteStaleLoginAttempts(before time.Time) (int64, error)
+
 	// Blog Methods
-	GetBlogs() ([]models.Blog, error)
+	GetBlogs(viewerID uint, q pagination.Query, include []string) ([]models.Blog, *types.Meta, error)
 	GetBlog(id uint) (*models.Blog, error)
 	CreateBlog(blog *models.Blog) (*models.Blog, error)
-	UpdateBlog(blog *models.Blog) error
+	UpdateBlog(blog *models.Blog, editorID uint, update BlogUpdate) error
+	GetBlogBySlug(slug string) (*models.Blog, error)
+	GetBlogByOldSlug(slug string) (*models.Blog, error)
+	SetBlogStatus(blog *models.Blog) error
+	PublishScheduledBlogs(now time.Time) (int64, error)
 	DeleteBlog(id uint) error
 
 	// Comment Methods
-	GetComments(blogID uint) ([]models.Comment, error)
+	GetComments(blogID, viewerID uint, q pagination.Query) ([]models.Comment, *types.Meta, error)
+	GetCommentTree(blogID, viewerID uint, q pagination.Query, depth, replies int) ([]*CommentNode, *types.Meta, error)
+	GetCommentThread(id, viewerID uint, depth, replies int) (*CommentNode, error)
+	GetCommentReplies(parentID, viewerID uint, q pagination.Query, depth, replies int) ([]*CommentNode, *types.Meta, error)
 	GetComment(id uint) (*models.Comment, error)
-	CreateComment(comment *models.Comment) error
-	UpdateComment(id uint, userID uint, content string) error
-	DeleteComment(id uint, userID uint) error
+	CreateComment(comment *models.Comment, reason string) error
+	UpdateComment(id uint, content, status, reason string) error
+	DeleteComment(id uint) error
 	UpdateView(blogId, userId uint) error
 
 	// Like functions
@@ -55,22 +158,37 @@ type Service interface {
 
 	// Admin functions
 	// User-related methods
-	AdminGetUsers() ([]models.User, error)
+	AdminGetUsers(q pagination.Query) ([]models.User, *types.Meta, error)
 	AdminGetUser(id uint) (*models.User, error)
 	AdminDeleteUser(id uint) error
 	AdminUpdateUser(user *models.User) error
 
 	// Blog-related methods
-	AdminGetBlogs() ([]models.Blog, error)
+	AdminGetBlogs(q pagination.Query, include []string) ([]models.Blog, *types.Meta, error)
 	AdminGetBlog(id uint) (*models.Blog, error)
 	AdminDeleteBlog(id uint) error
-	AdminUpdateBlog(blog *models.Blog) error
+	AdminUpdateBlog(blog *models.Blog, editorID uint) error
 
 	// Comment-related methods
 	AdminDeleteComment(id uint) error
 	AdminUpdateComment(id uint, content string) error
-	AdminGetComments() ([]models.Comment, error)
+	AdminGetComments(q pagination.Query) ([]models.Comment, *types.Meta, error)
+
+	// Comment moderation methods
+	GetModerationSettings() (*models.ModerationSettings, error)
+	UpdateModerationSettings(settings *models.ModerationSettings) error
+	SetBlogCommentModeration(blogID uint, mode string) error
+	HasApprovedComment(userID uint) (bool, error)
+	GetModerationQueue(status string, q pagination.Query) ([]models.Comment, *types.Meta, error)
+	ModerateComments(ids []uint, status, reason string, moderatorID uint) ([]models.Comment, error)
+	GetCommentDecisions(commentID uint) ([]models.CommentDecision, error)
+
+	// Spam classifier methods
+	GetSpamTokens(tokens []string) (map[string]models.SpamToken, models.SpamCorpus, error)
+	TrainSpam(commentID uint, tokens []string, label string) error
+	CountDuplicateComments(content string, since time.Time, excludeID uint) (int64, error)
 	GetAdminDashboardData() (DashboardData, error)
+	RecountCounters() (CounterRepairs, error)
 }
 
 var (
@@ -121,10 +239,80 @@ func New() Service {
 
 // MigrateSchema runs auto-migrations for all models
 func (s *service) MigrateSchema() {
-	err := s.DB.AutoMigrate(&models.User{}, &models.Blog{}, &models.Comment{}, &models.Like{}, &models.Follow{}, &models.View{})
+	// Accounts created before email verification existed are treated as verified
+	grandfatherVerification := s.DB.Migrator().HasTable(&models.User{}) && !s.DB.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+	// Default permissions are only seeded once so later changes by admins stick
+	seedPermissions := !s.DB.Migrator().HasTable(&models.RolePermission{})
+	// Blogs written before the lifecycle existed count as published when they were created
+	backfillPublishedAt := s.DB.Migrator().HasTable(&models.Blog{}) && !s.DB.Migrator().HasColumn(&models.Blog{}, "PublishedAt")
+	// Counter columns start at zero and are filled in from the rows they count
+	backfillCounters := s.DB.Migrator().HasTable(&models.Blog{}) && !s.DB.Migrator().HasColumn(&models.Blog{}, "LikesCount")
+	// Users who registered before password_set_at existed chose their password
+	backfillPasswordSetAt := s.DB.Migrator().HasTable(&models.User{}) && !s.DB.Migrator().HasColumn(&models.User{}, "PasswordSetAt")
+	// Follows were not unique before the follow_pair index
+	uniqueFollows := s.DB.Migrator().HasTable(&models.Follow{}) && !s.DB.Migrator().HasIndex(&models.Follow{}, "follow_pair")
+	// Existing blogs get their current content as the first revision
+	backfillRevisions := s.DB.Migrator().HasTable(&models.Blog{}) && !s.DB.Migrator().HasTable(&models.BlogRevision{})
+
+	if uniqueFollows {
+		if err := s.dedupeFollows(); err != nil {
+			log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+		}
+	}
+
+	err := s.DB.AutoMigrate(&models.User{}, &models.Blog{}, &models.Comment{}, &models.Like{}, &models.Follow{}, &models.View{}, &models.Session{}, &models.RefreshToken{}, &models.PersonalAccessToken{}, &models.PasswordReset{}, &models.RecoveryCode{}, &models.Identity{}, &models.LoginAttempt{}, &models.RolePermission{}, &models.BlogSlug{}, &models.Category{}, &models.Tag{}, &models.BlogRevision{}, &models.Media{}, &models.ModerationSettings{}, &models.CommentDecision{}, &models.SpamToken{}, &models.SpamCorpus{})
 	if err != nil {
 		log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
 	}
+
+	if grandfatherVerification {
+		if err := s.DB.Model(&models.User{}).Where("email_verified_at IS NULL").Update("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+		}
+	}
+	if backfillPasswordSetAt {
+		if err := s.migratePasswordSetAt(); err != nil {
+			log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+		}
+	}
+	if backfillPublishedAt {
+		if err := s.DB.Model(&models.Blog{}).Where("status = ? AND published_at IS NULL", models.BlogStatusPublished).Update("published_at", gorm.Expr("created_at")).Error; err != nil {
+			log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+		}
+	}
+	if backfillCounters || uniqueFollows {
+		if _, err := s.RecountCounters(); err != nil {
+			log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+		}
+	}
+	if backfillRevisions {
+		if err := s.backfillBlogRevisions(); err != nil {
+			log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+		}
+	}
+	if err := s.rerenderBlogs(); err != nil {
+		log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+	}
+	if err := s.migrateCommentAuthors(); err != nil {
+		log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+	}
+	if err := s.migrateCommentHashes(); err != nil {
+		log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+	}
+	if err := s.migrateSearchIndexes(); err != nil {
+		log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+	}
+	if err := s.backfillBlogSlugs(); err != nil {
+		log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+	}
+	if err := s.reslugTopics(); err != nil {
+		log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+	}
+	if seedPermissions {
+		if err := s.seedRolePermissions(); err != nil {
+			log.Fatalf("[DATABASE] ❌ Migration failed: %v", err)
+		}
+	}
 	log.Println("[DATABASE] ✅ Migration successful!")
 }
 
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// container is the Postgres container shared by the tests of the package, started by the
+// first test that needs it
+var container struct {
+	once      sync.Once
+	service   *service
+	err       error
+	terminate func(context.Context, ...testcontainers.TerminateOption) error
+}
+
+// startPostgresContainer runs a throwaway Postgres and points the connection settings at
+// it. testcontainers panics when it cannot find Docker, which is reported as an error.
+func startPostgresContainer() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	ctx := context.Background()
+	dbContainer, err := postgres.Run(ctx,
+		"postgres:16-alpine",
+		postgres.WithDatabase("database"),
+		postgres.WithUsername("user"),
+		postgres.WithPassword("password"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(30*time.Second)),
+	)
+	if err != nil {
+		return err
+	}
+	container.terminate = dbContainer.Terminate
+
+	dbHost, err := dbContainer.Host(ctx)
+	if err != nil {
+		return err
+	}
+	dbPort, err := dbContainer.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		return err
+	}
+
+	database, username, password = "database", "user", "password"
+	host, port = dbHost, dbPort.Port()
+	return nil
+}
+
+// testService connects to the shared container, skipping the test when Docker is not
+// available
+func testService(tb testing.TB) *service {
+	tb.Helper()
+	container.once.Do(func() {
+		if container.err = startPostgresContainer(); container.err == nil {
+			container.service = New().(*service)
+		}
+	})
+	if container.err != nil {
+		tb.Skipf("Postgres container is not available: %v", container.err)
+	}
+	return container.service
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if container.terminate != nil {
+		if err := container.terminate(context.Background()); err != nil {
+			log.Fatalf("could not teardown postgres container: %v", err)
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"obs/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLastLoginMethod is returned when unlinking an identity would leave a user unable to log in
+var ErrLastLoginMethod = errors.New("cannot unlink the only way to log in")
+
+// GetIdentity finds the identity a provider subject is linked to
+func (s *service) GetIdentity(provider, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	if err := s.DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// GetUserIdentities lists the external identities linked to a user
+func (s *service) GetUserIdentities(userID uint) ([]models.Identity, error) {
+	var identities []models.Identity
+	if err := s.DB.Where("user_id = ?", userID).Order("provider").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// CreateIdentity links an external identity to a user
+func (s *service) CreateIdentity(identity *models.Identity) error {
+	return s.DB.Create(identity).Error
+}
+
+// CreateUserWithIdentity creates a user and links their first external identity in one transaction
+func (s *service) CreateUserWithIdentity(user *models.User, identity *models.Identity) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
+
+// DeleteIdentity unlinks a provider from a user. It returns ErrLastLoginMethod when the
+// user has no password and no other identity to log in with.
+func (s *service) DeleteIdentity(userID uint, provider string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		// Locking the user serializes concurrent unlinks of their identities
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "password_set_at").First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var identities int64
+		if err := tx.Model(&models.Identity{}).Where("user_id = ?", userID).Count(&identities).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ? AND provider = ?", userID, provider).Delete(&models.Identity{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if !user.HasPassword() && identities <= 1 {
+			return ErrLastLoginMethod
+		}
+		return nil
+	})
+}
+
+// migratePasswordSetAt marks the users who chose a password. Accounts created through a
+// login provider are recognized by an identity linked within a minute of their creation.
+func (s *service) migratePasswordSetAt() error {
+	err := s.DB.Exec(`
+		UPDATE users SET password_set_at = created_at
+		WHERE password_set_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM identities
+			WHERE identities.user_id = users.id AND identities.created_at < users.created_at + interval '1 minute'
+		)`).Error
+	if err != nil {
+		log.Printf("[DATABASE] Error marking users with passwords: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"errors"
+	"obs/internal/models"
+	"testing"
+	"time"
+)
+
+func TestDeleteIdentityKeepsLastLoginMethod(t *testing.T) {
+	s := testService(t)
+
+	// An account created through a provider has no password of its own
+	user := models.User{Username: "provider-user", Email: "provider-user@example.com", Password: "unusable"}
+	identity := models.Identity{Provider: "first", Subject: "provider-user"}
+	if err := s.CreateUserWithIdentity(&user, &identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteIdentity(user.ID, "first"); !errors.Is(err, ErrLastLoginMethod) {
+		t.Fatalf("unlinking the only identity returned %v, want %v", err, ErrLastLoginMethod)
+	}
+
+	if err := s.CreateIdentity(&models.Identity{UserID: user.ID, Provider: "second", Subject: "provider-user"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteIdentity(user.ID, "first"); err != nil {
+		t.Fatalf("unlinking one of two identities: %v", err)
+	}
+	if err := s.DeleteIdentity(user.ID, "second"); !errors.Is(err, ErrLastLoginMethod) {
+		t.Fatalf("unlinking the remaining identity returned %v, want %v", err, ErrLastLoginMethod)
+	}
+
+	// Once the user has a password every identity can go
+	if err := s.DB.Model(&user).Update("password_set_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteIdentity(user.ID, "second"); err != nil {
+		t.Fatalf("unlinking with a password set: %v", err)
+	}
+}
@@ -7,14 +7,17 @@ import (
 	"gorm.io/gorm"
 )
 
-// Get the total number of likes for a blog
+// Get the total number of likes for a blog from its counter
 func (s *service) GetLikesForBlog(blogID uint) (int64, error) {
-	var count int64
-	err := s.DB.Model(&models.Like{}).Where("blog_id = ?", blogID).Count(&count).Error
+	var counts []int64
+	err := s.DB.Model(&models.Blog{}).Where("id = ?", blogID).Pluck("likes_count", &counts).Error
 	if err != nil {
 		return 0, err
 	}
-	return count, nil
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	return counts[0], nil
 }
 
 // Get a like entry by its ID
@@ -44,11 +47,13 @@ func (s *service) LikeBlog(like *models.Like) error {
 		return err // Return DB error if any
 	}
 
-	// Create a new like entry
-	if err := s.DB.Create(like).Error; err != nil {
-		return err
-	}
-	return nil
+	// Create a new like entry and count it
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(like).Error; err != nil {
+			return err
+		}
+		return adjustCounter(tx, &models.Blog{}, like.BlogID, "likes_count", 1)
+	})
 }
 
 // Unlike a blog (with existence check)
@@ -63,10 +68,7 @@ func (s *service) UnlikeBlog(userID, blogID uint) error {
 	}
 
 	// Delete the like entry
-	if err := s.DB.Delete(&like).Error; err != nil {
-		return err
-	}
-	return nil
+	return s.deleteLike(&like)
 }
 
 // Delete a like by its ID (checks if like exists before deleting)
@@ -79,10 +81,7 @@ func (s *service) DeleteLike(likeID uint) error {
 		return err
 	}
 
-	if err := s.DB.Delete(&like).Error; err != nil {
-		return err
-	}
-	return nil
+	return s.deleteLike(&like)
 }
 
 // GetLikeByUserAndBlog retrieves a like entry for a given user and blog
@@ -94,3 +93,15 @@ func (s *service) GetLikeByUserAndBlog(userID, blogID uint) (*models.Like, error
 	}
 	return &like, err
 }
+
+// deleteLike removes a like and uncounts it. Only the request that actually deleted the
+// row decrements, so concurrent unlikes cannot uncount the same like twice.
+func (s *service) deleteLike(like *models.Like) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(like)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return adjustCounter(tx, &models.Blog{}, like.BlogID, "likes_count", -1)
+	})
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"errors"
+	"obs/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetLoginAttempt fetches the failed login record for a key
+func (s *service) GetLoginAttempt(key string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	if err := s.DB.Where("key = ?", key).First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// UpdateLoginAttempt creates the record for a key if needed and applies update to it
+// while holding a row lock, so concurrent failures are all counted
+func (s *service) UpdateLoginAttempt(key string, update func(attempt *models.LoginAttempt)) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginAttempt{Key: key, LastFailureAt: time.Now()}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&attempt).Error; err != nil {
+			return err
+		}
+		update(&attempt)
+		return tx.Save(&attempt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// DeleteLoginAttempt removes the failed login record for a key
+func (s *service) DeleteLoginAttempt(key string) error {
+	return s.DB.Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+// GetLoginAttempts lists records with at least minFailures failures, or a lockout, since the given time
+func (s *service) GetLoginAttempts(minFailures int, since time.Time) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := s.DB.Where("(failures >= ? OR locked_until IS NOT NULL) AND (last_failure_at > ? OR locked_until > ?)", minFailures, since, time.Now()).
+		Order("last_failure_at DESC").
+		Find(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// DeleteStaleLoginAttempts deletes the records whose last failure was before the given
+// time and which are not locked out, returning how many were deleted
+func (s *service) DeleteStaleLoginAttempts(before time.Time) (int64, error) {
+	result := s.DB.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, time.Now()).Delete(&models.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
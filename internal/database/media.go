@@ -0,0 +1,257 @@
+package database
+
+import (
+	"errors"
+	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrQuotaExceeded is returned when an upload would take a user past their storage quota
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// MediaListSpec lists the sorts and filters supported by media listings
+var MediaListSpec = pagination.Spec{
+	Table: "media",
+	Sorts: map[string]pagination.Sort{
+		"created_at": {Expr: "media.created_at", Kind: pagination.Time},
+		"size":       {Expr: "media.size", Kind: pagination.Int},
+	},
+	DefaultSort: "created_at",
+	Filters: []pagination.Filter{
+		{Param: "kind", Column: "media.kind", Kind: pagination.String},
+	},
+}
+
+// CreateMedia records an uploaded file, unless it would take its owner's total past quota
+// bytes. The owner's row is locked so concurrent uploads cannot both slip under the quota.
+func (s *service) CreateMedia(media *models.Media, quota int64) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, media.UserID).Error; err != nil {
+			return err
+		}
+		usage, err := mediaUsage(tx, media.UserID)
+		if err != nil {
+			return err
+		}
+		if usage+media.Size > quota {
+			return ErrQuotaExceeded
+		}
+		return tx.Create(media).Error
+	})
+}
+
+// GetMedia fetches an uploaded file by ID
+func (s *service) GetMedia(id uint) (*models.Media, error) {
+	var media models.Media
+	if err := s.DB.First(&media, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &media, nil
+}
+
+// GetUserMedia fetches a page of a user's uploads
+func (s *service) GetUserMedia(userID uint, q pagination.Query) ([]models.Media, *types.Meta, error) {
+	var media []models.Media
+	meta, err := pagination.Find(s.DB.Model(&models.Media{}).Where("media.user_id = ?", userID), q, &media)
+	if err != nil {
+		return nil, nil, err
+	}
+	return media, meta, nil
+}
+
+// GetUserMediaKeys lists the storage keys of every file a user uploaded, renditions included
+func (s *service) GetUserMediaKeys(userID uint) ([]string, error) {
+	return mediaKeys(s.DB.Where("user_id = ?", userID))
+}
+
+// GetBlogMediaKeys lists the storage keys of the files uploaded for a blog, such as its cover
+func (s *service) GetBlogMediaKeys(blogID uint) ([]string, error) {
+	return mediaKeys(s.DB.Where("blog_id = ?", blogID))
+}
+
+// GetMediaUsage returns the bytes a user's uploads take up
+func (s *service) GetMediaUsage(userID uint) (int64, error) {
+	return mediaUsage(s.DB, userID)
+}
+
+// DeleteMedia deletes the record of an uploaded file
+func (s *service) DeleteMedia(id uint) error {
+	result := s.DB.Delete(&models.Media{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ClaimPendingMedia claims up to limit uploads waiting to be processed, oldest first, by
+// marking them processing and counting the attempt. Uploads whose claim was made before
+// staleBefore are claimed again, so they are retried when a processor failed or stopped
+// midway. Rows other processors are claiming are skipped rather than waited for.
+func (s *service) ClaimPendingMedia(limit int, staleBefore time.Time) ([]models.Media, error) {
+	var media []models.Media
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND claimed_at < ?)", models.MediaStatusPending, models.MediaStatusProcessing, staleBefore).
+			Order("id").Limit(limit).Find(&media).Error
+		if err != nil || len(media) == 0 {
+			return err
+		}
+
+		now := time.Now()
+		ids := make([]uint, len(media))
+		for i := range media {
+			ids[i] = media[i].ID
+			media[i].Status = models.MediaStatusProcessing
+			media[i].Attempts++
+			media[i].ClaimedAt = &now
+		}
+		return tx.Model(&models.Media{}).Where("id IN ?", ids).Updates(map[string]any{
+			"status":     models.MediaStatusProcessing,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"claimed_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// CompleteMedia marks a processed upload ready with the renditions set on media, and puts
+// it in place: an avatar becomes its owner's profile picture at url, a cover its blog's
+// cover. The uploads it replaces are deleted and returned so their files can be removed
+// too; an upload finishing after a newer one already replaced it is returned itself. It
+// returns gorm.ErrRecordNotFound when the upload was deleted or claimed again since
+// media.Attempts was claimed.
+func (s *service) CompleteMedia(media *models.Media, url string, urls models.Renditions) ([]models.Media, error) {
+	var replaced []models.Media
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Media{}).Where("id = ? AND status = ? AND attempts = ?", media.ID, models.MediaStatusProcessing, media.Attempts).Updates(map[string]any{
+			"status":     models.MediaStatusReady,
+			"error":      "",
+			"size":       media.Size,
+			"width":      media.Width,
+			"height":     media.Height,
+			"renditions": media.Renditions,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Deleted or claimed again while it was being processed
+			return gorm.ErrRecordNotFound
+		}
+
+		// Avatars replace the owner's previous avatar, covers the blog's previous cover
+		var slot *gorm.DB
+		switch {
+		case media.Kind == models.MediaKindAvatar:
+			slot = tx.Where("user_id = ? AND kind = ?", media.UserID, models.MediaKindAvatar)
+		case media.Kind == models.MediaKindCover && media.BlogID != nil:
+			slot = tx.Where("blog_id = ? AND kind = ?", *media.BlogID, models.MediaKindCover)
+		default:
+			return nil
+		}
+
+		var newer int64
+		if err := slot.Session(&gorm.Session{}).Model(&models.Media{}).Where("id > ? AND status = ?", media.ID, models.MediaStatusReady).Count(&newer).Error; err != nil {
+			return err
+		}
+		if newer > 0 {
+			media.Status = models.MediaStatusReady
+			replaced = append(replaced, *media)
+			return tx.Delete(&models.Media{}, media.ID).Error
+		}
+		if err := slot.Session(&gorm.Session{}).Where("id < ?", media.ID).Find(&replaced).Error; err != nil {
+			return err
+		}
+		if len(replaced) > 0 {
+			if err := tx.Delete(&replaced).Error; err != nil {
+				return err
+			}
+		}
+
+		if media.Kind == models.MediaKindAvatar {
+			return tx.Model(&models.User{}).Where("id = ?", media.UserID).Updates(map[string]any{
+				"pfp":            url,
+				"pfp_renditions": urls,
+			}).Error
+		}
+		return tx.Model(&models.Blog{}).Where("id = ?", *media.BlogID).Update("cover", urls).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+// FailMedia marks an upload that could not be processed. Its file is deleted, so it no
+// longer counts against the quota. It returns gorm.ErrRecordNotFound when the upload was
+// deleted or claimed again since the given attempt.
+func (s *service) FailMedia(id uint, attempt int, reason string) error {
+	result := s.DB.Model(&models.Media{}).Where("id = ? AND status = ? AND attempts = ?", id, models.MediaStatusProcessing, attempt).Updates(map[string]any{
+		"status": models.MediaStatusFailed,
+		"error":  reason,
+		"size":   0,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ClearBlogCover removes a blog's cover, returning the deleted cover uploads so their
+// files can be removed too
+func (s *service) ClearBlogCover(blogID uint) ([]models.Media, error) {
+	var covers []models.Media
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("blog_id = ? AND kind = ?", blogID, models.MediaKindCover).Find(&covers).Error; err != nil {
+			return err
+		}
+		if len(covers) > 0 {
+			if err := tx.Delete(&covers).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Blog{}).Where("id = ?", blogID).Update("cover", models.Renditions{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return covers, nil
+}
+
+// mediaKeys lists the storage keys of the media matched by query
+func mediaKeys(query *gorm.DB) ([]string, error) {
+	var media []models.Media
+	if err := query.Select("key", "renditions").Find(&media).Error; err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, m := range media {
+		keys = append(keys, m.StorageKeys()...)
+	}
+	return keys, nil
+}
+
+// mediaUsage sums the sizes of a user's uploads
+func mediaUsage(tx *gorm.DB, userID uint) (int64, error) {
+	var usage int64
+	err := tx.Model(&models.Media{}).Where("user_id = ?", userID).Select("COALESCE(SUM(size), 0)").Scan(&usage).Error
+	return usage, err
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+	"obs/internal/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestClaimPendingMediaHandsOutEachUploadOnce(t *testing.T) {
+	s := testService(t)
+
+	user := models.User{Username: "uploader", Email: "uploader@example.com", Password: "x"}
+	if err := s.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	media := models.Media{UserID: user.ID, Kind: models.MediaKindAvatar, Key: "avatars/1/claim.png", ContentType: "image/png", Size: 10, Status: models.MediaStatusPending}
+	if err := s.CreateMedia(&media, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.ClaimPendingMedia(10, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || first[0].ID != media.ID || first[0].Attempts != 1 {
+		t.Fatalf("first claim returned %+v", first)
+	}
+	second, err := s.ClaimPendingMedia(10, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 0 {
+		t.Fatalf("upload was claimed twice: %+v", second)
+	}
+
+	// Once the first claim goes stale the upload is claimed again, and the first
+	// processor can no longer complete it
+	retry, err := s.ClaimPendingMedia(10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retry) != 1 || retry[0].Attempts != 2 {
+		t.Fatalf("stale claim was not taken over: %+v", retry)
+	}
+	if _, err := s.CompleteMedia(&first[0], "", nil); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("completing a stale claim returned %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if _, err := s.CompleteMedia(&retry[0], "http://localhost/api/media/1", models.Renditions{}); err != nil {
+		t.Fatalf("completing the current claim: %v", err)
+	}
+}
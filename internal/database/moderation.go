@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// moderationSettingsID is the ID of the single row holding the site's moderation settings
+const moderationSettingsID = 1
+
+// ModerationQueueSpec lists the sorts and filters supported by the moderation queue,
+// which is worked through oldest first
+var ModerationQueueSpec = pagination.Spec{
+	Table: "comments",
+	Sorts: map[string]pagination.Sort{
+		"created_at": {Expr: "comments.created_at", Kind: pagination.Time},
+	},
+	DefaultSort: "created_at",
+	Ascending:   true,
+	Filters: []pagination.Filter{
+		{Param: "author_id", Column: "comments.user_id", Kind: pagination.Int},
+		{Param: "blog_id", Column: "comments.blog_id", Kind: pagination.Int},
+	},
+}
+
+// GetModerationSettings returns the site's moderation settings, the defaults if they
+// were never changed
+func (s *service) GetModerationSettings() (*models.ModerationSettings, error) {
+	settings := models.ModerationSettings{ID: moderationSettingsID, CommentModeration: models.ModerationOff}
+	if err := s.DB.First(&settings, moderationSettingsID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// UpdateModerationSettings saves the site's moderation settings
+func (s *service) UpdateModerationSettings(settings *models.ModerationSettings) error {
+	settings.ID = moderationSettingsID
+	return s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"comment_moderation", "updated_at"}),
+	}).Create(settings).Error
+}
+
+// SetBlogCommentModeration changes the moderation mode of the comments on a blog
+func (s *service) SetBlogCommentModeration(blogID uint, mode string) error {
+	result := s.DB.Model(&models.Blog{}).Where("id = ?", blogID).Update("comment_moderation", mode)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// HasApprovedComment reports whether a user has written a comment that was approved
+func (s *service) HasApprovedComment(userID uint) (bool, error) {
+	var exists bool
+	err := s.DB.Raw("SELECT EXISTS (SELECT 1 FROM comments WHERE user_id = ? AND status = ?)", userID, models.CommentStatusApproved).
+		Scan(&exists).Error
+	return exists, err
+}
+
+// GetModerationQueue retrieves a page of the comments in a moderation state, with user
+// info. Tombstones are left out as there is nothing left to moderate.
+func (s *service) GetModerationQueue(status string, q pagination.Query) ([]models.Comment, *types.Meta, error) {
+	var comments []models.Comment
+	query := s.DB.Model(&models.Comment{}).Where("comments.status = ? AND comments.deleted_at IS NULL", status)
+	meta, err := pagination.Find(query, q, &comments, func(db *gorm.DB) *gorm.DB {
+		return db.Preload("User")
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return comments, meta, nil
+}
+
+// ModerateComments moves comments to a moderation state, recording a decision with the
+// moderator and reason for each one, and keeps the blogs' comment counters in step. It
+// returns the comments that changed; missing comments, tombstones and comments already
+// in the state are skipped.
+func (s *service) ModerateComments(ids []uint, status, reason string, moderatorID uint) ([]models.Comment, error) {
+	var changed []models.Comment
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var comments []models.Comment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND deleted_at IS NULL AND status <> ?", ids, status).
+			Order("id").
+			Find(&comments).Error
+		if err != nil {
+			return err
+		}
+
+		for _, comment := range comments {
+			if err := setCommentStatus(tx, &comment, status, reason, &moderatorID); err != nil {
+				return err
+			}
+			changed = append(changed, comment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// setCommentStatus moves a locked comment to status, recording the decision, and counts
+// or uncounts it on its blog when it is approved or stops being approved
+func setCommentStatus(tx *gorm.DB, comment *models.Comment, status, reason string, moderatorID *uint) error {
+	decision := models.CommentDecision{
+		CommentID:   comment.ID,
+		ModeratorID: moderatorID,
+		FromStatus:  comment.Status,
+		Status:      status,
+		Reason:      reason,
+	}
+	if err := tx.Model(&models.Comment{}).Where("id = ?", comment.ID).Update("status", status).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&decision).Error; err != nil {
+		return err
+	}
+
+	delta := 0
+	if status == models.CommentStatusApproved {
+		delta = 1
+	} else if comment.IsApproved() {
+		delta = -1
+	}
+	comment.Status = status
+	if delta == 0 {
+		return nil
+	}
+	return adjustCounter(tx, &models.Blog{}, comment.BlogID, "comments_count", delta)
+}
+
+// GetCommentDecisions lists the moderation decisions made on a comment, oldest first
+func (s *service) GetCommentDecisions(commentID uint) ([]models.CommentDecision, error) {
+	decisions := []models.CommentDecision{}
+	if err := s.DB.Where("comment_id = ?", commentID).Order("created_at, id").Find(&decisions).Error; err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"log"
+	"obs/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreatePasswordReset stores a new password reset token
+func (s *service) CreatePasswordReset(reset *models.PasswordReset) error {
+	return s.DB.Create(reset).Error
+}
+
+// ResetPassword consumes a password reset token, sets the new password hash and
+// revokes every session and personal access token of the user in a single transaction. It returns
+// gorm.ErrRecordNotFound when the token is unknown, expired or already used.
+func (s *service) ResetPassword(tokenHash, hashedPassword string) (uint, error) {
+	var userID uint
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var reset models.PasswordReset
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).First(&reset).Error; err != nil {
+			return err
+		}
+
+		// Burn every outstanding reset token of the user, not just this one
+		result := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", reset.UserID).Updates(map[string]any{"password": hashedPassword, "password_set_at": now}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", reset.UserID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		// Tokens made by whoever knew the old password must stop working too
+		if err := tx.Model(&models.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", reset.UserID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		userID = reset.UserID
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("[DATABASE] Password reset for user %d", userID)
+	return userID, nil
+}
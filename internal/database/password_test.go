@@ -0,0 +1,41 @@
+package database
+
+import (
+	"obs/internal/models"
+	"testing"
+	"time"
+)
+
+func TestResetPasswordRevokesSessionsAndTokens(t *testing.T) {
+	s := testService(t)
+
+	user := models.User{Username: "forgetful", Email: "forgetful@example.com", Password: "old"}
+	if err := s.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	token := models.PersonalAccessToken{UserID: user.ID, Name: "ci", TokenHash: "reset-test-token", Prefix: "obs_reset"}
+	reset := models.PasswordReset{UserID: user.ID, TokenHash: "reset-test-reset", ExpiresAt: time.Now().Add(time.Hour)}
+	for _, row := range []any{&session, &token, &reset} {
+		if err := s.DB.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.ResetPassword(reset.TokenHash, "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DB.First(&session, session.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if session.RevokedAt == nil {
+		t.Error("session survived the password reset")
+	}
+	if err := s.DB.First(&token, token.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if token.RevokedAt == nil {
+		t.Error("personal access token survived the password reset")
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"log"
+	"obs/internal/markdown"
+	"obs/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// rerenderBatchSize is how many blogs rerenderBlogs loads at a time
+const rerenderBatchSize = 100
+
+// renderBlogContent renders a blog's Markdown content into its HTML, table of contents and reading statistics
+func renderBlogContent(blog *models.Blog) error {
+	doc, err := markdown.Render(blog.Content)
+	if err != nil {
+		return err
+	}
+	blog.ContentHTML = doc.HTML
+	blog.TOC = make(models.TableOfContents, len(doc.TOC))
+	for i, heading := range doc.TOC {
+		blog.TOC[i] = models.TOCEntry(heading)
+	}
+	blog.WordCount = doc.WordCount
+	blog.ReadingTime = doc.ReadingTime
+	blog.RenderedVersion = markdown.Version
+	return nil
+}
+
+// renderedColumns are the columns filled in by renderBlogContent
+func renderedColumns(blog *models.Blog) map[string]any {
+	return map[string]any{
+		"content_html":     blog.ContentHTML,
+		"toc":              blog.TOC,
+		"word_count":       blog.WordCount,
+		"reading_time":     blog.ReadingTime,
+		"rendered_version": blog.RenderedVersion,
+	}
+}
+
+// rerenderBlogs renders the blogs whose stored HTML predates the current renderer, which
+// includes every blog written before Markdown rendering existed
+func (s *service) rerenderBlogs() error {
+	var blogs []models.Blog
+	var rendered int
+	result := s.DB.Select("id", "content").
+		Where("rendered_version < ?", markdown.Version).
+		FindInBatches(&blogs, rerenderBatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range blogs {
+				if err := renderBlogContent(&blogs[i]); err != nil {
+					return err
+				}
+				if err := s.DB.Model(&models.Blog{}).Where("id = ?", blogs[i].ID).UpdateColumns(renderedColumns(&blogs[i])).Error; err != nil {
+					return err
+				}
+			}
+			rendered += len(blogs)
+			return nil
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if rendered > 0 {
+		log.Printf("[DATABASE] Rendered the content of %d blogs", rendered)
+	}
+	return nil
+}
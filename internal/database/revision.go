@@ -0,0 +1,93 @@
+package database
+
+import (
+	"errors"
+	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+
+	"gorm.io/gorm"
+)
+
+// RevisionListSpec lists the sorts and filters supported by revision listings
+var RevisionListSpec = pagination.Spec{
+	Table: "blog_revisions",
+	Sorts: map[string]pagination.Sort{
+		"number": {Expr: "blog_revisions.number", Kind: pagination.Int},
+	},
+	DefaultSort: "number",
+	Filters: []pagination.Filter{
+		{Param: "editor_id", Column: "blog_revisions.editor_id", Kind: pagination.Int},
+	},
+}
+
+// GetBlogRevisions retrieves a page of the revisions of a blog, without their content
+func (s *service) GetBlogRevisions(blogID uint, q pagination.Query) ([]models.BlogRevision, *types.Meta, error) {
+	var revisions []models.BlogRevision
+	query := s.DB.Model(&models.BlogRevision{}).Where("blog_revisions.blog_id = ?", blogID)
+	meta, err := pagination.Find(query, q, &revisions, func(db *gorm.DB) *gorm.DB {
+		return db.Omit("Content")
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return revisions, meta, nil
+}
+
+// GetBlogRevision fetches a revision of a blog by its number
+func (s *service) GetBlogRevision(blogID uint, number int) (*models.BlogRevision, error) {
+	var revision models.BlogRevision
+	if err := s.DB.Where("blog_id = ? AND number = ?", blogID, number).First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// GetLatestBlogRevision fetches the revision holding a blog's current content
+func (s *service) GetLatestBlogRevision(blogID uint) (*models.BlogRevision, error) {
+	var revision models.BlogRevision
+	if err := s.DB.Where("blog_id = ?", blogID).Order("number DESC").First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// RestoreBlogRevision makes an older revision's title and content current again. The
+// restore is saved as a new revision, so it can itself be undone.
+func (s *service) RestoreBlogRevision(blog *models.Blog, revision *models.BlogRevision, editorID uint) error {
+	blog.Title = revision.Title
+	blog.Content = revision.Content
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return updateBlogContent(tx, blog, models.BlogRevision{EditorID: &editorID, RestoredFrom: &revision.Number})
+	})
+}
+
+// recordRevision saves the blog's current title and content as its next revision. Callers
+// hold the blog's row lock, which keeps revision numbers sequential.
+func recordRevision(tx *gorm.DB, blog *models.Blog, revision models.BlogRevision) error {
+	if err := tx.Model(&models.BlogRevision{}).
+		Where("blog_id = ?", blog.ID).
+		Select("COALESCE(MAX(number), 0) + 1").
+		Scan(&revision.Number).Error; err != nil {
+		return err
+	}
+	revision.BlogID = blog.ID
+	revision.Title = blog.Title
+	revision.Content = blog.Content
+	return tx.Create(&revision).Error
+}
+
+// backfillBlogRevisions records the current content of blogs written before revisions
+// existed as their first revision
+func (s *service) backfillBlogRevisions() error {
+	return s.DB.Exec(`
+		INSERT INTO blog_revisions (blog_id, number, title, content, editor_id, created_at)
+		SELECT id, 1, title, content, user_id, NOW() FROM blogs
+		WHERE NOT EXISTS (SELECT 1 FROM blog_revisions WHERE blog_revisions.blog_id = blogs.id)`).Error
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"log"
+	"obs/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetRolePermissions lists every permission granted to a role
+func (s *service) GetRolePermissions() ([]models.RolePermission, error) {
+	var permissions []models.RolePermission
+	if err := s.DB.Order("role, permission").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// RoleHasPermission reports whether a role grants a permission. Admins hold every permission.
+func (s *service) RoleHasPermission(role, permission string) (bool, error) {
+	if role == models.RoleAdmin {
+		return true, nil
+	}
+
+	var count int64
+	err := s.DB.Model(&models.RolePermission{}).
+		Where("role = ? AND permission = ?", role, permission).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GrantPermission adds a permission to a role, doing nothing if it is already granted
+func (s *service) GrantPermission(role, permission string) error {
+	return s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RolePermission{Role: role, Permission: permission}).Error
+}
+
+// RevokePermission removes a permission from a role
+func (s *service) RevokePermission(role, permission string) error {
+	result := s.DB.Where("role = ? AND permission = ?", role, permission).Delete(&models.RolePermission{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetUserRole changes a user's role
+func (s *service) SetUserRole(userID uint, role string) error {
+	result := s.DB.Model(&models.User{}).Where("id = ?", userID).Update("role", role)
+	if result.Error != nil {
+		log.Printf("[DATABASE] Error updating role of user %d: %v", userID, result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	log.Printf("[DATABASE] User ID %d is now %s", userID, role)
+	return nil
+}
+
+// BanUser suspends a user and revokes all of their sessions
+func (s *service) BanUser(userID uint, reason string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+			"banned_at":  now,
+			"ban_reason": reason,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// UnbanUser lifts a user's suspension
+func (s *service) UnbanUser(userID uint) error {
+	result := s.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"banned_at":  nil,
+		"ban_reason": "",
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// seedRolePermissions grants the default permissions to each role
+func (s *service) seedRolePermissions() error {
+	var permissions []models.RolePermission
+	for role, perms := range models.DefaultRolePermissions {
+		for _, permission := range perms {
+			permissions = append(permissions, models.RolePermission{Role: role, Permission: permission})
+		}
+	}
+	return s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&permissions).Error
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"html"
+	"log"
+	"obs/internal/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// searchConfig is the Postgres text search configuration used for indexing and querying.
+// Changing it requires recreating the search_vector columns.
+const searchConfig = "english"
+
+// searchHeadlineOptions configures the highlighted snippets returned by ts_headline
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \""
+
+// escapedText escapes a text column as HTML inside SQL, so ts_headline only adds the <mark> tags
+const escapedText = "replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+
+// substringSnippetRadius is how much text is shown around a match on the ILIKE fallback path
+const substringSnippetRadius = 80
+
+// Search modes reported back to clients
+const (
+	SearchModeFullText  = "fulltext"
+	SearchModeSubstring = "substring"
+)
+
+// SearchFilters narrows a search. Blog filters also apply to the blogs comments belong to.
+type SearchFilters struct {
+	Query    string
+	Author   string     // Username of the blog or comment author
+	Tag      string     // Tag slug the blog must have
+	From     *time.Time // Earliest publication (or comment) time
+	To       *time.Time // Latest publication (or comment) time
+	ViewerID uint       // Unpublished blogs of this user are searched too
+	Limit    int
+	Offset   int
+}
+
+// BlogSearchResult is a blog matching a search, with highlighted title and snippet
+type BlogSearchResult struct {
+	ID             uint       `json:"id"`
+	Title          string     `json:"title"`
+	Slug           string     `json:"slug"`
+	Author         string     `json:"author"`
+	UserID         uint       `json:"user_id"`
+	Status         string     `json:"status"`
+	PublishedAt    *time.Time `json:"published_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Rank           float64    `json:"rank"`
+	TitleHighlight string     `json:"title_highlight"`
+	Snippet        string     `json:"snippet"`
+}
+
+// CommentSearchResult is a comment matching a search, with a highlighted snippet
+type CommentSearchResult struct {
+	ID        uint      `json:"id"`
+	BlogID    uint      `json:"blog_id"`
+	BlogTitle string    `json:"blog_title"`
+	BlogSlug  string    `json:"blog_slug"`
+	Author    string    `json:"author"`
+	UserID    uint      `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Rank      float64   `json:"rank"`
+	Snippet   string    `json:"snippet"`
+	Content   string    `json:"-"`
+}
+
+// SearchBlogs runs a full-text search over blog titles and content, ranked by relevance. When
+// the full-text query finds nothing, e.g. for partial words, it falls back to a substring match.
+func (s *service) SearchBlogs(filters SearchFilters) ([]BlogSearchResult, string, error) {
+	results := []BlogSearchResult{}
+
+	ranked := s.DB.Table("blogs").
+		Select("blogs.id, ts_rank_cd(blogs.search_vector, query) AS rank").
+		Joins("CROSS JOIN websearch_to_tsquery(?, ?) AS query", searchConfig, filters.Query).
+		Where("blogs.search_vector @@ query").
+		Scopes(visibleBlogs(filters.ViewerID), blogSearchFilters(filters)).
+		Order("rank DESC, blogs.published_at DESC NULLS LAST, blogs.id DESC").
+		Limit(filters.Limit).Offset(filters.Offset)
+
+	err := s.DB.Table("(?) AS ranked", ranked).
+		Select(`blogs.id, blogs.title, blogs.slug, blogs.author, blogs.user_id, blogs.status, blogs.published_at, blogs.created_at, ranked.rank,
+			ts_headline(?, `+sqlEscaped("blogs.title")+`, query, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>') AS title_highlight,
+			ts_headline(?, `+sqlEscaped("blogs.content")+`, query, ?) AS snippet`, searchConfig, searchConfig, searchHeadlineOptions).
+		Joins("JOIN blogs ON blogs.id = ranked.id").
+		Joins("CROSS JOIN websearch_to_tsquery(?, ?) AS query", searchConfig, filters.Query).
+		Order("ranked.rank DESC, blogs.published_at DESC NULLS LAST, blogs.id DESC").
+		Scan(&results).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if len(results) > 0 || filters.Offset > 0 {
+		return results, SearchModeFullText, nil
+	}
+
+	// Fallback: case-insensitive substring match, newest first
+	var blogs []models.Blog
+	pattern := likePattern(filters.Query)
+	err = s.DB.Model(&models.Blog{}).
+		Where("blogs.title ILIKE ? OR blogs.content ILIKE ?", pattern, pattern).
+		Scopes(visibleBlogs(filters.ViewerID), blogSearchFilters(filters)).
+		Order("blogs.published_at DESC NULLS LAST, blogs.id DESC").
+		Limit(filters.Limit).
+		Find(&blogs).Error
+	if err != nil {
+		return nil, "", err
+	}
+	for _, blog := range blogs {
+		results = append(results, BlogSearchResult{
+			ID:             blog.ID,
+			Title:          blog.Title,
+			Slug:           blog.Slug,
+			Author:         blog.Author,
+			UserID:         blog.UserID,
+			Status:         blog.Status,
+			PublishedAt:    blog.PublishedAt,
+			CreatedAt:      blog.CreatedAt,
+			TitleHighlight: substringSnippet(blog.Title, filters.Query, len(blog.Title)),
+			Snippet:        substringSnippet(blog.Content, filters.Query, substringSnippetRadius),
+		})
+	}
+	return results, SearchModeSubstring, nil
+}
+
+// SearchComments runs a full-text search over comments on blogs the viewer may see, with
+// the same substring fallback as SearchBlogs
+func (s *service) SearchComments(filters SearchFilters) ([]CommentSearchResult, string, error) {
+	results := []CommentSearchResult{}
+
+	ranked := s.DB.Table("comments").
+		Select("comments.id, ts_rank_cd(comments.search_vector, query) AS rank").
+		Joins("JOIN blogs ON blogs.id = comments.blog_id").
+		Joins("CROSS JOIN websearch_to_tsquery(?, ?) AS query", searchConfig, filters.Query).
+		Where("comments.search_vector @@ query AND comments.deleted_at IS NULL AND comments.status = ?", models.CommentStatusApproved).
+		Scopes(visibleBlogs(filters.ViewerID), commentSearchFilters(filters)).
+		Order("rank DESC, comments.created_at DESC, comments.id DESC").
+		Limit(filters.Limit).Offset(filters.Offset)
+
+	err := s.DB.Table("(?) AS ranked", ranked).
+		Select(`comments.id, comments.blog_id, blogs.title AS blog_title, blogs.slug AS blog_slug, comments.author, comments.user_id, comments.created_at, ranked.rank,
+			ts_headline(?, `+sqlEscaped("comments.content")+`, query, ?) AS snippet`, searchConfig, searchHeadlineOptions).
+		Joins("JOIN comments ON comments.id = ranked.id").
+		Joins("JOIN blogs ON blogs.id = comments.blog_id").
+		Joins("CROSS JOIN websearch_to_tsquery(?, ?) AS query", searchConfig, filters.Query).
+		Order("ranked.rank DESC, comments.created_at DESC, comments.id DESC").
+		Scan(&results).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if len(results) > 0 || filters.Offset > 0 {
+		return results, SearchModeFullText, nil
+	}
+
+	pattern := likePattern(filters.Query)
+	err = s.DB.Table("comments").
+		Select("comments.id, comments.blog_id, blogs.title AS blog_title, blogs.slug AS blog_slug, comments.author, comments.user_id, comments.created_at, comments.content").
+		Joins("JOIN blogs ON blogs.id = comments.blog_id").
+		Where("comments.content ILIKE ? AND comments.deleted_at IS NULL AND comments.status = ?", pattern, models.CommentStatusApproved).
+		Scopes(visibleBlogs(filters.ViewerID), commentSearchFilters(filters)).
+		Order("comments.created_at DESC, comments.id DESC").
+		Limit(filters.Limit).
+		Scan(&results).Error
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range results {
+		results[i].Snippet = substringSnippet(results[i].Content, filters.Query, substringSnippetRadius)
+	}
+	return results, SearchModeSubstring, nil
+}
+
+// blogSearchFilters applies the author, tag and date filters to a query joined on blogs
+func blogSearchFilters(filters SearchFilters) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filters.Author != "" {
+			db = db.Where("LOWER(blogs.author) = LOWER(?)", filters.Author)
+		}
+		if filters.Tag != "" {
+			db = db.Where("EXISTS (SELECT 1 FROM blog_tags JOIN tags ON tags.id = blog_tags.tag_id WHERE blog_tags.blog_id = blogs.id AND tags.slug = ?)", filters.Tag)
+		}
+		if filters.From != nil {
+			db = db.Where("COALESCE(blogs.published_at, blogs.created_at) >= ?", *filters.From)
+		}
+		if filters.To != nil {
+			db = db.Where("COALESCE(blogs.published_at, blogs.created_at) <= ?", *filters.To)
+		}
+		return db
+	}
+}
+
+// commentSearchFilters applies the author and date filters to comments and the tag filter to their blogs
+func commentSearchFilters(filters SearchFilters) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filters.Author != "" {
+			db = db.Where("LOWER(comments.author) = LOWER(?)", filters.Author)
+		}
+		if filters.Tag != "" {
+			db = db.Where("EXISTS (SELECT 1 FROM blog_tags JOIN tags ON tags.id = blog_tags.tag_id WHERE blog_tags.blog_id = blogs.id AND tags.slug = ?)", filters.Tag)
+		}
+		if filters.From != nil {
+			db = db.Where("comments.created_at >= ?", *filters.From)
+		}
+		if filters.To != nil {
+			db = db.Where("comments.created_at <= ?", *filters.To)
+		}
+		return db
+	}
+}
+
+// migrateSearchIndexes adds the weighted tsvector columns and their GIN indexes. The columns
+// are generated by Postgres, so they stay in sync without any application code.
+func (s *service) migrateSearchIndexes() error {
+	statements := []string{
+		`ALTER TABLE blogs ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('` + searchConfig + `', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('` + searchConfig + `', coalesce(content, '')), 'B')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_blogs_search_vector ON blogs USING GIN (search_vector)`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			to_tsvector('` + searchConfig + `', coalesce(content, ''))
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING GIN (search_vector)`,
+	}
+	for _, statement := range statements {
+		if err := s.DB.Exec(statement).Error; err != nil {
+			log.Printf("[DATABASE] Error creating search indexes: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlEscaped wraps a column in the HTML escaping expression
+func sqlEscaped(column string) string {
+	return strings.Replace(escapedText, "%s", column, 1)
+}
+
+// likePattern builds an ILIKE pattern matching the query anywhere, with wildcards escaped
+func likePattern(query string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+	return "%" + escaped + "%"
+}
+
+// substringSnippet cuts the text around the first case-insensitive match of query, escapes it
+// as HTML and marks the match, mirroring the ts_headline output of the full-text path
+func substringSnippet(text, query string, radius int) string {
+	lower, needle := strings.ToLower(text), strings.ToLower(query)
+	i := strings.Index(lower, needle)
+	// Lowercasing can change byte lengths; fall back to the start of the text if offsets drift
+	if i < 0 || len(lower) != len(text) {
+		return html.EscapeString(truncateRunes(text, 2*radius))
+	}
+
+	start, end := i-radius, i+len(needle)+radius
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	// Move the cut points onto rune boundaries
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("… ")
+	}
+	b.WriteString(html.EscapeString(text[start:i]))
+	b.WriteString("<mark>" + html.EscapeString(text[i:i+len(needle)]) + "</mark>")
+	b.WriteString(html.EscapeString(text[i+len(needle) : end]))
+	if end < len(text) {
+		b.WriteString(" …")
+	}
+	return b.String()
+}
+
+// truncateRunes shortens text to at most n runes
+func truncateRunes(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n]) + " …"
+}
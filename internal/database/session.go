@@ -0,0 +1,126 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"obs/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// CreateSession stores a new session together with its first refresh token
+func (s *service) CreateSession(session *models.Session, token *models.RefreshToken) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		token.SessionID = session.ID
+		return tx.Create(token).Error
+	})
+}
+
+// GetSession fetches a session by its ID along with its user
+func (s *service) GetSession(id uint) (*models.Session, error) {
+	var session models.Session
+	if err := s.DB.Preload("User").First(&session, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetRefreshToken looks up a refresh token by its hash along with its session
+func (s *service) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := s.DB.Preload("Session").Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken marks the old refresh token as used and stores its replacement.
+// It returns ErrRefreshTokenReused if the old token was consumed concurrently.
+func (s *service) RotateRefreshToken(old *models.RefreshToken, next *models.RefreshToken) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", old.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		next.SessionID = old.SessionID
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).Where("id = ?", old.SessionID).Update("expires_at", next.ExpiresAt).Error
+	})
+}
+
+// RevokeSession marks a session as revoked so its tokens stop working
+func (s *service) RevokeSession(id uint) error {
+	result := s.DB.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Printf("[DATABASE] Error revoking session %d: %v", id, result.Error)
+		return result.Error
+	}
+	return nil
+}
+
+// GetUserSessions lists the active sessions of a user, most recently used first
+func (s *service) GetUserSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeUserSession revokes a single session, making sure it belongs to the given user
+func (s *service) RevokeUserSession(userID, sessionID uint) error {
+	result := s.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeAllSessions revokes every active session of a user except exceptID (pass 0 to revoke all)
+func (s *service) RevokeAllSessions(userID, exceptID uint) (int64, error) {
+	result := s.DB.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Printf("[DATABASE] Error revoking sessions for user %d: %v", userID, result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// TouchSession records that a session was just used from the given IP
+func (s *service) TouchSession(id uint, ip string) error {
+	return s.DB.Model(&models.Session{}).Where("id = ?", id).Updates(map[string]any{
+		"last_seen_at": time.Now(),
+		"ip":           ip,
+	}).Error
+}
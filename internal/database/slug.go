@@ -0,0 +1,161 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"obs/internal/models"
+	"obs/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// blogSlugLockKey is the Postgres advisory lock that serializes slug allocation, so
+// two posts with the same title cannot both claim the same slug
+const blogSlugLockKey = 7_210_013
+
+// GetBlogBySlug fetches a blog by its current slug along with its related data
+func (s *service) GetBlogBySlug(slug string) (*models.Blog, error) {
+	var blog models.Blog
+	if err := s.DB.Preload("User").Preload("Comments", "status = ?", models.CommentStatusApproved).Preload("Likes").Preload("Tags").Preload("Category").Where("blogs.slug = ?", slug).First(&blog).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &blog, nil
+}
+
+// GetBlogByOldSlug fetches the blog a previous slug belonged to
+func (s *service) GetBlogByOldSlug(slug string) (*models.Blog, error) {
+	var old models.BlogSlug
+	if err := s.DB.Preload("Blog.User").Where("slug = ?", slug).First(&old).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &old.Blog, nil
+}
+
+// allocateBlogSlug returns a slug for the title that no other blog uses now or used before,
+// adding a numeric suffix on collisions. It must run inside a transaction.
+func allocateBlogSlug(tx *gorm.DB, title string, blogID uint) (string, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", blogSlugLockKey).Error; err != nil {
+		return "", err
+	}
+
+	base := utils.Slugify(title)
+	var taken []string
+	err := tx.Raw(`
+		SELECT slug FROM blogs WHERE (slug = @base OR slug LIKE @pattern) AND id <> @id
+		UNION
+		SELECT slug FROM blog_slugs WHERE (slug = @base OR slug LIKE @pattern) AND blog_id <> @id`,
+		map[string]any{"base": base, "pattern": base + "-%", "id": blogID},
+	).Scan(&taken).Error
+	if err != nil {
+		return "", err
+	}
+
+	used := make(map[string]bool, len(taken))
+	for _, slug := range taken {
+		used[slug] = true
+	}
+
+	slug := base
+	for n := 2; used[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug, nil
+}
+
+// reslugBlog gives a renamed blog a slug matching its new title and keeps the old one
+// in the slug history. It must run inside a transaction.
+func reslugBlog(tx *gorm.DB, blogID uint, currentSlug, title string) (string, error) {
+	slug, err := allocateBlogSlug(tx, title, blogID)
+	if err != nil || slug == currentSlug {
+		return currentSlug, err
+	}
+
+	if currentSlug != "" {
+		if err := tx.Create(&models.BlogSlug{BlogID: blogID, Slug: currentSlug}).Error; err != nil {
+			return "", err
+		}
+	}
+	// Renaming back to an earlier title reclaims its slug from the history
+	if err := tx.Where("blog_id = ? AND slug = ?", blogID, slug).Delete(&models.BlogSlug{}).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Model(&models.Blog{}).Where("id = ?", blogID).Update("slug", slug).Error; err != nil {
+		return "", err
+	}
+	return slug, nil
+}
+
+// updateBlogContent updates a blog's title and content within tx, reslugging it if the
+// title changed. A change is recorded as a new revision, filled in from the given editor
+// and restore details.
+func updateBlogContent(tx *gorm.DB, blog *models.Blog, revision models.BlogRevision) error {
+	var existing models.Blog
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "title", "content", "slug").First(&existing, blog.ID).Error; err != nil {
+		return err
+	}
+	if blog.Title == existing.Title && blog.Content == existing.Content {
+		blog.Slug = existing.Slug
+		return nil
+	}
+
+	if err := renderBlogContent(blog); err != nil {
+		return err
+	}
+	columns := renderedColumns(blog)
+	columns["title"] = blog.Title
+	columns["content"] = blog.Content
+	if err := tx.Model(&models.Blog{}).Where("id = ?", blog.ID).Updates(columns).Error; err != nil {
+		return err
+	}
+	if err := recordRevision(tx, blog, revision); err != nil {
+		return err
+	}
+
+	blog.Slug = existing.Slug
+	if blog.Title == existing.Title && existing.Slug != "" {
+		return nil
+	}
+	slug, err := reslugBlog(tx, blog.ID, existing.Slug, blog.Title)
+	blog.Slug = slug
+	return err
+}
+
+// backfillBlogSlugs assigns slugs to blogs created before slugs existed, and readable ones
+// to blogs that got the fallback slug before letters of every script were kept. The
+// fallback slugs stay in the slug history, so links to them keep working.
+func (s *service) backfillBlogSlugs() error {
+	var blogs []models.Blog
+	err := s.DB.Select("id", "title", "slug").
+		Where("slug IS NULL OR slug = '' OR slug ~ ?", "^"+utils.FallbackSlug+"(-[0-9]+)?$").
+		Order("id").Find(&blogs).Error
+	if err != nil {
+		return err
+	}
+
+	assigned := 0
+	for _, blog := range blogs {
+		if blog.Slug != "" && utils.Slugify(blog.Title) == utils.FallbackSlug {
+			continue
+		}
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			_, err := reslugBlog(tx, blog.ID, blog.Slug, blog.Title)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		assigned++
+	}
+	if assigned > 0 {
+		log.Printf("[DATABASE] Assigned slugs to %d blogs", assigned)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"obs/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// spamCorpusID is the ID of the single row counting the trained comments
+const spamCorpusID = 1
+
+// contentHash is the SQL expression fingerprinting comment content for duplicate
+// detection. Case and runs of whitespace are ignored, so trivially varied copies match.
+const contentHash = `md5(lower(regexp_replace(btrim(%s), '\s+', ' ', 'g')))`
+
+// GetSpamTokens fetches the trained counts of the given tokens, leaving out tokens that
+// were never trained, and of the whole corpus
+func (s *service) GetSpamTokens(tokens []string) (map[string]models.SpamToken, models.SpamCorpus, error) {
+	counts := make(map[string]models.SpamToken, len(tokens))
+	var corpus models.SpamCorpus
+	if err := s.DB.First(&corpus, spamCorpusID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, corpus, err
+	}
+	if len(tokens) == 0 {
+		return counts, corpus, nil
+	}
+
+	var rows []models.SpamToken
+	if err := s.DB.Where("token IN ?", tokens).Find(&rows).Error; err != nil {
+		return nil, corpus, err
+	}
+	for _, row := range rows {
+		counts[row.Token] = row
+	}
+	return counts, corpus, nil
+}
+
+// TrainSpam labels a comment for the spam classifier and counts its tokens under the
+// label. A comment trained with the other label before is moved over, so moderators can
+// correct earlier decisions; training it again with the same label does nothing. Tokens
+// must be distinct.
+func (s *service) TrainSpam(commentID uint, tokens []string, label string) error {
+	if label != models.SpamLabelSpam && label != models.SpamLabelHam {
+		return fmt.Errorf("unknown spam label %q", label)
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var comment models.Comment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "spam_label").First(&comment, commentID).Error; err != nil {
+			return err
+		}
+		previous := comment.SpamLabel
+		if previous == label {
+			return nil
+		}
+
+		// The label names the counter column of both tables
+		counts := map[string]any{label: gorm.Expr(label + " + 1")}
+		if previous != "" {
+			counts[previous] = gorm.Expr("GREATEST(" + previous + " - 1, 0)")
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SpamCorpus{ID: spamCorpusID}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.SpamCorpus{}).Where("id = ?", spamCorpusID).Updates(counts).Error; err != nil {
+			return err
+		}
+
+		if len(tokens) > 0 {
+			if previous != "" {
+				err := tx.Model(&models.SpamToken{}).Where("token IN ?", tokens).Updates(map[string]any{previous: counts[previous]}).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			// One row per token, counted under the label or added to its existing counts
+			rows := make([]models.SpamToken, len(tokens))
+			for i, token := range tokens {
+				rows[i] = models.SpamToken{Token: token}
+				if label == models.SpamLabelSpam {
+					rows[i].Spam = 1
+				} else {
+					rows[i].Ham = 1
+				}
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "token"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					label:        gorm.Expr("spam_tokens." + label + " + 1"),
+					"updated_at": gorm.Expr("NOW()"),
+				}),
+			}).Create(&rows).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.Comment{}).Where("id = ?", commentID).Update("spam_label", label).Error
+	})
+}
+
+// CountDuplicateComments counts the comments posted since the given time with the same
+// content, ignoring case and whitespace. The comment excludeID is left out, so an edited
+// comment is not a copy of itself.
+func (s *service) CountDuplicateComments(content string, since time.Time, excludeID uint) (int64, error) {
+	var count int64
+	err := s.DB.Model(&models.Comment{}).
+		Where("content_hash = "+fmt.Sprintf(contentHash, "?")+" AND created_at >= ? AND id <> ? AND deleted_at IS NULL", content, since, excludeID).
+		Count(&count).Error
+	return count, err
+}
+
+// migrateCommentHashes adds the generated content hash column duplicate detection looks
+// comments up by, and its index
+func (s *service) migrateCommentHashes() error {
+	statements := []string{
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS content_hash text GENERATED ALWAYS AS (` + fmt.Sprintf(contentHash, "content") + `) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_content_hash ON comments (content_hash, created_at)`,
+	}
+	for _, statement := range statements {
+		if err := s.DB.Exec(statement).Error; err != nil {
+			log.Printf("[DATABASE] Error creating comment hashes: %v", err)
+			return err
+		}
+	}
+	return nil
+}
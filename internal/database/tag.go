@@ -0,0 +1,198 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTagExists is returned when renaming a tag to the name of another tag
+var ErrTagExists = errors.New("a tag with this name already exists")
+
+// GetTags lists tags with the number of published blogs using them, most used first.
+// A non-empty prefix limits the result to tags whose slug starts with it.
+func (s *service) GetTags(prefix string, limit int) ([]models.Tag, error) {
+	var tags []models.Tag
+	query := s.DB.Model(&models.Tag{}).
+		Select("tags.*, COUNT(blogs.id) AS blog_count").
+		Joins("LEFT JOIN blog_tags ON blog_tags.tag_id = tags.id").
+		Joins("LEFT JOIN blogs ON blogs.id = blog_tags.blog_id AND blogs.status = ?", models.BlogStatusPublished).
+		Group("tags.id").
+		Order("blog_count DESC, tags.name")
+	if prefix != "" {
+		query = query.Where("tags.slug LIKE ?", utils.TopicSlug(prefix)+"%")
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetTag fetches a tag by ID
+func (s *service) GetTag(id uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := s.DB.First(&tag, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetBlogsByTag retrieves a page of the blogs with a tag that viewerID may see
+func (s *service) GetBlogsByTag(slug string, viewerID uint, q pagination.Query, include []string) ([]models.Blog, *types.Meta, error) {
+	var blogs []models.Blog
+	query := s.DB.Model(&models.Blog{}).
+		Joins("JOIN blog_tags ON blog_tags.blog_id = blogs.id").
+		Joins("JOIN tags ON tags.id = blog_tags.tag_id AND tags.slug = ?", slug).
+		Scopes(visibleBlogs(viewerID))
+	meta, err := pagination.Find(query, q, &blogs, blogListing(include))
+	if err != nil {
+		return nil, nil, err
+	}
+	return blogs, meta, nil
+}
+
+// setBlogTags replaces the tags of a blog within tx, creating tags that do not exist yet
+func setBlogTags(tx *gorm.DB, blogID uint, names []string) ([]models.Tag, error) {
+	tags, err := resolveTags(tx, names)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.Blog{ID: blogID}).Omit("Tags.*").Association("Tags").Replace(tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// RenameTag changes the name and slug of a tag
+func (s *service) RenameTag(id uint, name string) (*models.Tag, error) {
+	var tag models.Tag
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&tag, id).Error; err != nil {
+			return err
+		}
+
+		slug := utils.TopicSlug(name)
+		var count int64
+		if err := tx.Model(&models.Tag{}).Where("slug = ? AND id <> ?", slug, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrTagExists
+		}
+
+		tag.Name, tag.Slug = strings.TrimSpace(name), slug
+		return tx.Model(&tag).Updates(map[string]any{"name": tag.Name, "slug": tag.Slug}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// MergeTags moves every blog tagged with sourceID over to targetID and deletes the source tag
+func (s *service) MergeTags(sourceID, targetID uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Tag{}).Where("id IN ?", []uint{sourceID, targetID}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count != 2 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO blog_tags (blog_id, tag_id)
+			SELECT blog_id, ? FROM blog_tags WHERE tag_id = ?
+			ON CONFLICT DO NOTHING`, targetID, sourceID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM blog_tags WHERE tag_id = ?", sourceID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Tag{}, sourceID).Error
+	})
+}
+
+// resolveTags finds or creates a tag for each name, ignoring names that slugify to the same tag
+func resolveTags(tx *gorm.DB, names []string) ([]models.Tag, error) {
+	var create []models.Tag
+	var slugs []string
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		slug := utils.TopicSlug(name)
+		if name == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		slugs = append(slugs, slug)
+		create = append(create, models.Tag{Name: name, Slug: slug})
+	}
+
+	tags := []models.Tag{}
+	if len(create) == 0 {
+		return tags, nil
+	}
+
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "slug"}}, DoNothing: true}).Create(&create).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("slug IN ?", slugs).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// reslugTopics gives tags and categories the slug utils.TopicSlug makes of their name,
+// unless another one has it. Slugs used to drop letters outside the Latin, Greek and
+// Cyrillic scripts and the "+" and "#" of names like "C++", so such names shared one.
+func (s *service) reslugTopics() error {
+	var updated int64
+	for _, table := range []string{"tags", "categories"} {
+		var rows []struct {
+			ID   uint
+			Name string
+			Slug string
+		}
+		if err := s.DB.Table(table).Select("id", "name", "slug").Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			slug := utils.TopicSlug(row.Name)
+			if slug == row.Slug {
+				continue
+			}
+			result := s.DB.Exec("UPDATE "+table+" SET slug = ? WHERE id = ? AND NOT EXISTS (SELECT 1 FROM "+table+" WHERE slug = ?)", slug, row.ID, slug)
+			if result.Error != nil {
+				return result.Error
+			}
+			updated += result.RowsAffected
+		}
+	}
+	if updated > 0 {
+		log.Printf("[DATABASE] Updated the slugs of %d tags and categories", updated)
+	}
+	return nil
+}
+
+// tagNames returns the names of tags
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
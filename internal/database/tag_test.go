@@ -0,0 +1,59 @@
+package database
+
+import (
+	"obs/internal/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestResolveTagsKeepsDistinctNamesApart(t *testing.T) {
+	s := testService(t)
+
+	names := []string{"C", "C++", "C#", "中文", "日本語", "한국어", "c"}
+	var tags []models.Tag
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tags, err = resolveTags(tx, names)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only "c" folds into "C"
+	slugs := map[string]bool{}
+	for _, tag := range tags {
+		slugs[tag.Slug] = true
+	}
+	if len(slugs) != len(names)-1 {
+		t.Fatalf("tags %v were merged into %d slugs: %v", names, len(slugs), slugs)
+	}
+}
+
+func TestDeleteCategoryInUse(t *testing.T) {
+	s := testService(t)
+
+	user := models.User{Username: "categorizer", Email: "categorizer@example.com", Password: "x"}
+	if err := s.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	category := models.Category{Name: "Doomed", Slug: "doomed"}
+	if err := s.CreateCategory(&category); err != nil {
+		t.Fatal(err)
+	}
+	blog := models.Blog{Title: "Filed away", Content: "In a category about to go", UserID: user.ID, Author: user.Username, Slug: "filed-away", CategoryID: &category.ID}
+	if err := s.DB.Omit("Tags").Create(&blog).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteCategory(category.ID); err != nil {
+		t.Fatalf("deleting a category in use: %v", err)
+	}
+	if err := s.DB.First(&blog, blog.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if blog.CategoryID != nil {
+		t.Fatalf("blog still points at deleted category %d", *blog.CategoryID)
+	}
+}
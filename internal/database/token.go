@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+	"obs/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreatePersonalAccessToken stores a new personal access token
+func (s *service) CreatePersonalAccessToken(token *models.PersonalAccessToken) error {
+	return s.DB.Create(token).Error
+}
+
+// GetPersonalAccessTokens lists the tokens of a user that have not been revoked
+func (s *service) GetPersonalAccessTokens(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	if err := s.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// GetPersonalAccessTokenByHash looks up a token by its hash along with its owner
+func (s *service) GetPersonalAccessTokenByHash(tokenHash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	if err := s.DB.Preload("User").Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokePersonalAccessToken revokes a token, making sure it belongs to the given user
+func (s *service) RevokePersonalAccessToken(userID, tokenID uint) error {
+	result := s.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchPersonalAccessToken records that a token was just used
+func (s *service) TouchPersonalAccessToken(id uint) error {
+	return s.DB.Model(&models.PersonalAccessToken{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"log"
+	"obs/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SetTOTPSecret stores a pending TOTP secret for a user who has not enabled 2FA yet
+func (s *service) SetTOTPSecret(userID uint, secret string) error {
+	result := s.DB.Model(&models.User{}).
+		Where("id = ? AND totp_enabled_at IS NULL", userID).
+		Update("totp_secret", secret)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// EnableTwoFactor turns on 2FA for a user and stores a fresh set of hashed recovery codes
+func (s *service) EnableTwoFactor(userID uint, step int64, codeHashes []string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+			"totp_enabled_at": time.Now(),
+			"totp_last_step":  step,
+		}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// DisableTwoFactor clears the TOTP secret and recovery codes of a user
+func (s *service) DisableTwoFactor(userID uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// ReplaceRecoveryCodes invalidates all recovery codes of a user and stores new ones
+func (s *service) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left
+func (s *service) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := s.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// UseTOTPStep records a TOTP time step as used. It returns false if the step,
+// or a later one, was already accepted so a code cannot be replayed.
+func (s *service) UseTOTPStep(userID uint, step int64) (bool, error) {
+	result := s.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseRecoveryCode consumes a recovery code. It returns false if the code is unknown or already used.
+func (s *service) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := s.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		log.Printf("[DATABASE] Error using recovery code for user %d: %v", userID, result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// replaceRecoveryCodes deletes the old recovery codes of a user and inserts the new hashes
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	codes := make([]models.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
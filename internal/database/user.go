@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"log"
 	"obs/internal/models"
+	"obs/internal/pagination"
+	"obs/internal/types"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CreateUser inserts a new user into the database
@@ -45,31 +50,49 @@ func (s *service) GetUser(id uint) (*models.User, error) {
 	return &user, nil
 }
 
-// GetUsers fetches all users
-func (s *service) GetUsers() ([]models.User, error) {
-	var users []models.User
-	result := s.DB.
-		Preload("Followers").
-		Preload("Following").
-		Find(&users)
+// UserListSpec lists the sorts and filters supported by user listings
+var UserListSpec = pagination.Spec{
+	Table: "users",
+	Sorts: map[string]pagination.Sort{
+		"created_at": {Expr: "users.created_at", Kind: pagination.Time},
+		"username":   {Expr: "users.username", Kind: pagination.String},
+		"followers":  {Expr: "users.followers_count", Kind: pagination.Int},
+	},
+	DefaultSort: "created_at",
+	Filters: []pagination.Filter{
+		{Param: "role", Column: "users.role", Kind: pagination.String},
+	},
+}
 
-	if result.Error != nil {
-		log.Printf("[DATABASE] Error retrieving users: %v", result.Error)
-		return nil, result.Error
+// GetUsers fetches a page of users
+func (s *service) GetUsers(q pagination.Query) ([]models.User, *types.Meta, error) {
+	var users []models.User
+	meta, err := pagination.Find(s.DB.Model(&models.User{}), q, &users)
+	if err != nil {
+		log.Printf("[DATABASE] Error retrieving users: %v", err)
+		return nil, nil, err
 	}
-	return users, nil
+	return users, meta, nil
 }
 
 // DeleteUser deletes a user by ID
 func (s *service) DeleteUser(id uint) error {
-	// Permanently delete the user
-	result := s.DB.Unscoped().Delete(&models.User{}, id)
-	if result.Error != nil {
-		log.Printf("[DATABASE] Error deleting user with ID %d: %v", id, result.Error)
+	// Permanently delete the user, uncounting their likes, views, comments and follows first
+	var deleted int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := releaseUserCounters(tx, id); err != nil {
+			return err
+		}
+		result := tx.Unscoped().Delete(&models.User{}, id)
+		deleted = result.RowsAffected
 		return result.Error
+	})
+	if err != nil {
+		log.Printf("[DATABASE] Error deleting user with ID %d: %v", id, err)
+		return err
 	}
 
-	if result.RowsAffected == 0 {
+	if deleted == 0 {
 		log.Printf("[DATABASE] No user found with ID %d to delete", id)
 		return errors.New("user not found")
 	}
@@ -94,11 +117,33 @@ func (s *service) UpdateUser(user *models.User) error {
 		return errors.New("user not found")
 	}
 
-	// Only update fields that are not zero values
-	result := s.DB.Model(&existingUser).Updates(user)
-	if result.Error != nil {
-		log.Printf("[DATABASE] Error updating user: %v", result.Error)
-		return result.Error
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Only update fields that are not zero values; counters are only changed by follows,
+		// avatar renditions by the image pipeline, verification by the verification link,
+		// the password by a reset and the role by admins
+		result := tx.Model(&existingUser).Omit("FollowersCount", "FollowingCount", "PfpRenditions", "EmailVerifiedAt", "VerificationSentAt", "Password", "PasswordSetAt", "Role").Updates(user)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		reset := map[string]any{}
+		// Renditions of an uploaded avatar no longer apply to a different picture
+		if user.Pfp != "" && user.Pfp != existingUser.Pfp {
+			reset["pfp_renditions"] = models.Renditions{}
+		}
+		// A new email address has to be verified again
+		if user.Email != "" && !strings.EqualFold(user.Email, existingUser.Email) {
+			reset["email_verified_at"] = nil
+			reset["verification_sent_at"] = nil
+		}
+		if len(reset) == 0 {
+			return nil
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(reset).Error
+	})
+	if err != nil {
+		log.Printf("[DATABASE] Error updating user: %v", err)
+		return err
 	}
 
 	log.Printf("[DATABASE] User ID %d updated successfully", user.ID)
@@ -121,40 +166,69 @@ func (s *service) FollowUser(followerID, followedID uint) error {
 		return errors.New("a user cannot follow themselves")
 	}
 
-	// Check if the follow relationship already exists
-	var existingFollow models.Follow
-	result := s.DB.Where("follower_id = ? AND followed_id = ?", followerID, followedID).First(&existingFollow)
-	if result.Error == nil {
-		return errors.New("already following this user")
-	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		log.Printf("[DATABASE] Error checking follow relationship: %v", result.Error)
-		return result.Error
-	}
-
-	// Create a new follow relationship
+	// Create the follow relationship and count it on both users, unless it already exists
 	follow := models.Follow{
 		FollowerID: followerID,
 		FollowedID: followedID,
 	}
-	if err := s.DB.Create(&follow).Error; err != nil {
+	var created int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		created = result.RowsAffected
+		if err := adjustCounter(tx, &models.User{}, followedID, "followers_count", 1); err != nil {
+			return err
+		}
+		return adjustCounter(tx, &models.User{}, followerID, "following_count", 1)
+	})
+	if err != nil {
 		log.Printf("[DATABASE] Error following user: %v", err)
 		return err
 	}
 
+	if created == 0 {
+		return errors.New("already following this user")
+	}
+
 	log.Printf("[DATABASE] User %d followed user %d", followerID, followedID)
 	return nil
 }
 
+// dedupeFollows deletes repeated follows of the same user, keeping the first, so the
+// unique follow_pair index can be created. Counters are recounted afterwards.
+func (s *service) dedupeFollows() error {
+	err := s.DB.Exec(`
+		DELETE FROM follows a USING follows b
+		WHERE a.follower_id = b.follower_id AND a.followed_id = b.followed_id AND a.id > b.id`).Error
+	if err != nil {
+		log.Printf("[DATABASE] Error removing duplicate follows: %v", err)
+	}
+	return err
+}
+
 // UnfollowUser allows a user to unfollow another user
 func (s *service) UnfollowUser(followerID, followedID uint) error {
-	result := s.DB.Where("follower_id = ? AND followed_id = ?", followerID, followedID).Delete(&models.Follow{})
+	var deleted int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("follower_id = ? AND followed_id = ?", followerID, followedID).Delete(&models.Follow{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		if err := adjustCounter(tx, &models.User{}, followedID, "followers_count", -1); err != nil {
+			return err
+		}
+		return adjustCounter(tx, &models.User{}, followerID, "following_count", -1)
+	})
 
-	if result.Error != nil {
-		log.Printf("[DATABASE] Error unfollowing user: %v", result.Error)
-		return result.Error
+	if err != nil {
+		log.Printf("[DATABASE] Error unfollowing user: %v", err)
+		return err
 	}
 
-	if result.RowsAffected == 0 {
+	if deleted == 0 {
 		return errors.New("not following this user")
 	}
 
@@ -175,3 +249,23 @@ func (s *service) IsFollowing(followerID, followedID uint) (bool, error) {
 	}
 	return true, nil
 }
+
+// MarkEmailVerified marks the user's email as verified if it still matches the verified address
+func (s *service) MarkEmailVerified(userID uint, email string) error {
+	result := s.DB.Model(&models.User{}).
+		Where("id = ? AND LOWER(email) = LOWER(?)", userID, email).
+		Update("email_verified_at", gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()))
+	if result.Error != nil {
+		log.Printf("[DATABASE] Error verifying email for user %d: %v", userID, result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetVerificationSentAt records when the last verification email was sent to the user
+func (s *service) SetVerificationSentAt(userID uint, sentAt time.Time) error {
+	return s.DB.Model(&models.User{}).Where("id = ?", userID).Update("verification_sent_at", sentAt).Error
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"obs/internal/models"
+	"testing"
+	"time"
+)
+
+func TestEmailChangesNeedVerification(t *testing.T) {
+	s := testService(t)
+
+	verified := time.Now()
+	user := models.User{Username: "mover", Email: "mover@example.com", Password: "x", EmailVerifiedAt: &verified}
+	if err := s.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	isVerified := func() bool {
+		t.Helper()
+		stored, err := s.GetUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stored.IsEmailVerified()
+	}
+
+	// Claiming verification in the update does not carry it over to the new address
+	if err := s.UpdateUser(&models.User{ID: user.ID, Email: "someone-else@example.com", EmailVerifiedAt: &verified}); err != nil {
+		t.Fatal(err)
+	}
+	if isVerified() {
+		t.Fatal("changed email address is treated as verified")
+	}
+
+	if err := s.MarkEmailVerified(user.ID, "someone-else@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AdminUpdateUser(&models.User{ID: user.ID, Username: "mover", Email: "third@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if isVerified() {
+		t.Fatal("email address changed by an admin is treated as verified")
+	}
+}
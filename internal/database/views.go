@@ -3,6 +3,9 @@ package database
 import (
 	"errors"
 	"obs/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func (s *service) UpdateView(blogId, userId uint) error {
@@ -15,7 +18,12 @@ func (s *service) UpdateView(blogId, userId uint) error {
 		BlogID: blogId,
 	}
 
-	// Use `FirstOrCreate` to ensure a unique view per user per blog
-	result := s.DB.FirstOrCreate(&view, models.View{UserID: userId, BlogID: blogId})
-	return result.Error
+	// The unique index keeps one view per user per blog; only a new view is counted
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&view)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return adjustCounter(tx, &models.Blog{}, blogId, "views_count", 1)
+	})
 }
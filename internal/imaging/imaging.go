@@ -0,0 +1,175 @@
+// Package imaging turns uploaded images into resized renditions, or strips images served
+// as uploaded. Both are re-encoded from the decoded pixels, so none of the original's
+// metadata (EXIF, GPS, comments) survives.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Sizes are the longest edges, in pixels, of the renditions made of every image
+var Sizes = []int{64, 256, 1024}
+
+// Decoding limits. Images are checked against them before their pixels are decoded, so a
+// small file declaring a huge canvas (a decompression bomb) never gets allocated.
+const (
+	MaxDimension = 12000
+	MaxPixels    = 40_000_000
+)
+
+// jpegQuality balances size and quality for photos at display sizes
+const jpegQuality = 82
+
+// ContentType is the type of every rendition
+const ContentType = "image/jpeg"
+
+// ErrTooLarge is returned for images past the decoding limits
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// Rendition is an encoded, resized copy of an image
+type Rendition struct {
+	Name   string // Longest edge the rendition was made for, e.g. "256"
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Process decodes an image and encodes a JPEG rendition for each of Sizes, returning
+// them with the dimensions of the original. Square renditions are center-cropped, as
+// avatars are; others keep the aspect ratio. Images are never scaled up, and
+// transparency is flattened onto white.
+func Process(data []byte, square bool) ([]Rendition, image.Point, error) {
+	if err := checkLimits(data); err != nil {
+		return nil, image.Point{}, err
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, image.Point{}, fmt.Errorf("corrupt image: %w", err)
+	}
+	// Cameras store photos sideways and record how to turn them, in the metadata about to
+	// be dropped. Turning commutes with the center crop and the scaling, so it is applied
+	// to the small renditions rather than the full image.
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	size := src.Bounds().Size()
+	if orientation >= 5 {
+		size.X, size.Y = size.Y, size.X
+	}
+	if square {
+		src = cropSquare(src)
+	}
+
+	renditions := make([]Rendition, 0, len(Sizes))
+	for _, edge := range Sizes {
+		scaled := image.NewRGBA(fitWithin(src.Bounds().Size(), edge))
+		draw.Draw(scaled, scaled.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), src, src.Bounds(), draw.Over, nil)
+		dst := orient(scaled, orientation)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, image.Point{}, err
+		}
+		renditions = append(renditions, Rendition{
+			Name:   strconv.Itoa(edge),
+			Width:  dst.Bounds().Dx(),
+			Height: dst.Bounds().Dy(),
+			Data:   buf.Bytes(),
+		})
+	}
+	return renditions, size, nil
+}
+
+// Strip re-encodes an image from its decoded pixels, dropping its metadata, and returns
+// it with its content type. JPEG, PNG and GIF keep their format, animation included;
+// WebP, which there is no encoder for, becomes PNG. JPEGs are turned upright, as their
+// orientation is part of the dropped EXIF.
+func Strip(data []byte) ([]byte, string, error) {
+	if err := checkLimits(data); err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	_, format, _ := image.DecodeConfig(bytes.NewReader(data))
+	if format == "gif" {
+		// Only frames and the loop count are written back, not comments or application data
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("corrupt image: %w", err)
+		}
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/gif", nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("corrupt image: %w", err)
+	}
+	if format == "jpeg" {
+		upright := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+		draw.Draw(upright, upright.Bounds(), src, src.Bounds().Min, draw.Src)
+		if err := jpeg.Encode(&buf, orient(upright, jpegOrientation(data)), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+	if err := png.Encode(&buf, src); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// checkLimits reads the dimensions an image declares, rejecting images past the decoding
+// limits before their pixels are decoded
+func checkLimits(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unsupported image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return errors.New("image has no pixels")
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension || config.Width*config.Height > MaxPixels {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// fitWithin scales size down so its longest edge is at most edge
+func fitWithin(size image.Point, edge int) image.Rectangle {
+	if size.X <= edge && size.Y <= edge {
+		return image.Rect(0, 0, size.X, size.Y)
+	}
+	if size.X >= size.Y {
+		return image.Rect(0, 0, edge, max(1, size.Y*edge/size.X))
+	}
+	return image.Rect(0, 0, max(1, size.X*edge/size.Y), edge)
+}
+
+// cropSquare returns the largest centered square of img
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x, y), draw.Src)
+	return dst
+}
@@ -0,0 +1,85 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// photoWithEXIF encodes a w by h JPEG carrying an EXIF segment with the given orientation
+// and a GPS marker that must not survive stripping
+func photoWithEXIF(t *testing.T, w, h int, orientation uint16) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Little-endian TIFF with one IFD holding the orientation, followed by the marker
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.LittleEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 52.3676N 4.9041E"...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func TestStripDropsMetadata(t *testing.T) {
+	data := photoWithEXIF(t, 40, 30, 1)
+	if !bytes.Contains(data, []byte("GPS")) {
+		t.Fatal("test photo lacks its metadata")
+	}
+
+	stripped, contentType, err := Strip(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/jpeg" {
+		t.Fatalf("content type %q, want image/jpeg", contentType)
+	}
+	if bytes.Contains(stripped, []byte("Exif")) || bytes.Contains(stripped, []byte("GPS")) {
+		t.Fatal("stripped image still carries the EXIF segment")
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 40 || config.Height != 30 {
+		t.Fatalf("stripped image is %dx%d, want 40x30", config.Width, config.Height)
+	}
+}
+
+func TestStripTurnsPhotosUpright(t *testing.T) {
+	// Orientation 6: stored sideways, to be turned right for display
+	stripped, _, err := Strip(photoWithEXIF(t, 40, 30, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 30 || config.Height != 40 {
+		t.Fatalf("stripped image is %dx%d, want the upright 30x40", config.Width, config.Height)
+	}
+}
@@ -0,0 +1,123 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// exifOrientationTag is the EXIF tag recording how a photo must be turned for display
+const exifOrientationTag = 0x0112
+
+// jpegOrientation reads the EXIF orientation (1 to 8) of a JPEG file, or 1 when it has
+// none. Only the APP1 segments before the image data are inspected.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 || marker == 0xFF {
+			// Markers without a length
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan or end of image: metadata comes before either
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			if o := tiffOrientation(segment[6:]); o != 0 {
+				return o
+			}
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of EXIF's TIFF structure,
+// returning 0 when it is missing or invalid
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		// A SHORT value is stored in the first bytes of the value field
+		if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+			return o
+		}
+		return 0
+	}
+	return 0
+}
+
+// orient applies an EXIF orientation to img, returning the upright image. Orientations 5
+// to 8 swap width and height.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored
+				dx, dy = w-1-x, y
+			case 3: // Upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // Upside down and mirrored
+				dx, dy = x, h-1-y
+			case 5: // Mirrored and turned left
+				dx, dy = y, x
+			case 6: // Turned left, needs a right turn
+				dx, dy = h-1-y, x
+			case 7: // Mirrored and turned right
+				dx, dy = h-1-y, w-1-x
+			case 8: // Turned right, needs a left turn
+				dx, dy = y, w-1-x
+			}
+			si := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], img.Pix[si:si+4])
+		}
+	}
+	return dst
+}
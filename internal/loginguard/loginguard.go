@@ -0,0 +1,153 @@
+package loginguard
+
+import (
+	"log"
+	"math"
+	"obs/internal/database"
+	"obs/internal/models"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tracker records failed logins and decides when further attempts must wait
+type Tracker interface {
+	// Check reports whether a login for the key is currently allowed
+	Check(key string) (Status, error)
+	// RecordFailure counts a failed login and returns the resulting status
+	RecordFailure(key string) (Status, error)
+	// Reset forgets the failures of a key after a successful login
+	Reset(key string) error
+	// List returns the keys that are currently throttled or locked
+	List() ([]models.LoginAttempt, error)
+	// Clear removes a key, lifting any lockout
+	Clear(key string) error
+	// Prune drops the keys whose failures no longer count and returns how many
+	Prune() (int64, error)
+}
+
+// Status describes whether a key may attempt a login right now
+type Status struct {
+	Blocked     bool          `json:"blocked"`
+	Locked      bool          `json:"locked"`
+	Failures    int           `json:"failures"`
+	RetryAfter  time.Duration `json:"-"`
+	LockedUntil *time.Time    `json:"locked_until,omitempty"`
+}
+
+// Policy configures the backoff and lockout behaviour
+type Policy struct {
+	FreeAttempts     int           // Failures allowed before backoff starts
+	BaseDelay        time.Duration // First backoff delay, doubled on every further failure
+	MaxDelay         time.Duration // Upper bound for the backoff delay
+	LockoutThreshold int           // Failures that trigger a temporary lockout
+	LockoutDuration  time.Duration // How long a lockout lasts
+	FailureWindow    time.Duration // Failures older than this are forgotten
+}
+
+// DefaultPolicy is used when no environment overrides are set
+var DefaultPolicy = Policy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	FailureWindow:    24 * time.Hour,
+}
+
+// AccountKey builds the tracker key for an account identifier
+func AccountKey(identifier string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// IPKey builds the tracker key for a client IP
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// New builds the tracker selected by LOGIN_GUARD ("memory" or "postgres", the default).
+// LOGIN_LOCKOUT_THRESHOLD and LOGIN_LOCKOUT_MINUTES override the default policy.
+func New(db database.Service) Tracker {
+	policy := DefaultPolicy
+	if v, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_THRESHOLD")); err == nil && v > 0 {
+		policy.LockoutThreshold = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_MINUTES")); err == nil && v > 0 {
+		policy.LockoutDuration = time.Duration(v) * time.Minute
+	}
+
+	switch strings.ToLower(os.Getenv("LOGIN_GUARD")) {
+	case "memory":
+		log.Println("[LOGIN GUARD] Using in-memory login attempt tracker")
+		return NewMemoryTracker(policy)
+	default:
+		return NewPostgresTracker(db, policy)
+	}
+}
+
+// status evaluates an attempt record at the given time
+func (p Policy) status(attempt *models.LoginAttempt, now time.Time) Status {
+	if attempt == nil || p.isStale(attempt, now) {
+		return Status{}
+	}
+
+	status := Status{Failures: attempt.Failures}
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		status.Blocked = true
+		status.Locked = true
+		status.LockedUntil = attempt.LockedUntil
+		status.RetryAfter = attempt.LockedUntil.Sub(now)
+		return status
+	}
+
+	if attempt.LockedUntil == nil && attempt.Failures > p.FreeAttempts {
+		if nextAllowed := attempt.LastFailureAt.Add(p.delay(attempt.Failures)); now.Before(nextAllowed) {
+			status.Blocked = true
+			status.RetryAfter = nextAllowed.Sub(now)
+		}
+	}
+	return status
+}
+
+// recordFailure updates an attempt record for a new failure at the given time
+func (p Policy) recordFailure(attempt *models.LoginAttempt, now time.Time) {
+	// Start over once failures are old or a lockout has been served
+	if p.isStale(attempt, now) || (attempt.LockedUntil != nil && !now.Before(*attempt.LockedUntil)) {
+		attempt.Failures = 0
+		attempt.LockedUntil = nil
+	}
+
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	if attempt.Failures >= p.LockoutThreshold {
+		lockedUntil := now.Add(p.LockoutDuration)
+		attempt.LockedUntil = &lockedUntil
+	}
+}
+
+// delay returns the exponential backoff after the given number of failures
+func (p Policy) delay(failures int) time.Duration {
+	exponent := failures - p.FreeAttempts - 1
+	if exponent < 0 {
+		return 0
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(exponent))
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// isStale reports whether the failures of an attempt are too old to count
+func (p Policy) isStale(attempt *models.LoginAttempt, now time.Time) bool {
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		return false
+	}
+	return now.Sub(attempt.LastFailureAt) > p.FailureWindow
+}
+
+// isTracked reports whether an attempt should show up in the admin listing
+func (p Policy) isTracked(attempt *models.LoginAttempt, now time.Time) bool {
+	return !p.isStale(attempt, now) && (attempt.Failures > p.FreeAttempts || attempt.LockedUntil != nil)
+}
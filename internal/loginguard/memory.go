@@ -0,0 +1,97 @@
+package loginguard
+
+import (
+	"obs/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryTracker keeps login attempts in process memory. It is suited to a single
+// instance deployment or development; state is lost on restart.
+type MemoryTracker struct {
+	policy Policy
+
+	mu       sync.Mutex
+	attempts map[string]*models.LoginAttempt
+}
+
+// NewMemoryTracker creates an empty in-memory tracker
+func NewMemoryTracker(policy Policy) *MemoryTracker {
+	return &MemoryTracker{policy: policy, attempts: make(map[string]*models.LoginAttempt)}
+}
+
+// Check reports whether a login for the key is currently allowed
+func (t *MemoryTracker) Check(key string) (Status, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.policy.status(t.attempts[key], time.Now()), nil
+}
+
+// RecordFailure counts a failed login and returns the resulting status
+func (t *MemoryTracker) RecordFailure(key string) (Status, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+
+	attempt, ok := t.attempts[key]
+	if !ok {
+		attempt = &models.LoginAttempt{Key: key, CreatedAt: now}
+		t.attempts[key] = attempt
+	}
+	t.policy.recordFailure(attempt, now)
+	attempt.UpdatedAt = now
+	return t.policy.status(attempt, now), nil
+}
+
+// Reset forgets the failures of a key after a successful login
+func (t *MemoryTracker) Reset(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.attempts, key)
+	return nil
+}
+
+// List returns the keys that are currently throttled or locked
+func (t *MemoryTracker) List() ([]models.LoginAttempt, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	attempts := []models.LoginAttempt{}
+	for _, attempt := range t.attempts {
+		if t.policy.isTracked(attempt, now) {
+			attempts = append(attempts, *attempt)
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].LastFailureAt.After(attempts[j].LastFailureAt)
+	})
+	return attempts, nil
+}
+
+// Clear removes a key, lifting any lockout
+func (t *MemoryTracker) Clear(key string) error {
+	return t.Reset(key)
+}
+
+// Prune drops the attempts whose failures no longer count
+func (t *MemoryTracker) Prune() (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return int64(t.prune(time.Now())), nil
+}
+
+// prune drops attempts whose failures no longer count so the map cannot grow without bound
+func (t *MemoryTracker) prune(now time.Time) int {
+	pruned := 0
+	for key, attempt := range t.attempts {
+		if t.policy.isStale(attempt, now) {
+			delete(t.attempts, key)
+			pruned++
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,72 @@
+package loginguard
+
+import (
+	"obs/internal/database"
+	"obs/internal/models"
+	"time"
+)
+
+// PostgresTracker stores login attempts in the database so limits are shared
+// between instances and survive restarts
+type PostgresTracker struct {
+	policy Policy
+	db     database.Service
+}
+
+// NewPostgresTracker creates a tracker backed by the login_attempts table
+func NewPostgresTracker(db database.Service, policy Policy) *PostgresTracker {
+	return &PostgresTracker{policy: policy, db: db}
+}
+
+// Check reports whether a login for the key is currently allowed
+func (t *PostgresTracker) Check(key string) (Status, error) {
+	attempt, err := t.db.GetLoginAttempt(key)
+	if err != nil {
+		return Status{}, err
+	}
+	return t.policy.status(attempt, time.Now()), nil
+}
+
+// RecordFailure counts a failed login and returns the resulting status
+func (t *PostgresTracker) RecordFailure(key string) (Status, error) {
+	now := time.Now()
+	attempt, err := t.db.UpdateLoginAttempt(key, func(attempt *models.LoginAttempt) {
+		t.policy.recordFailure(attempt, now)
+	})
+	if err != nil {
+		return Status{}, err
+	}
+	return t.policy.status(attempt, now), nil
+}
+
+// Reset forgets the failures of a key after a successful login
+func (t *PostgresTracker) Reset(key string) error {
+	return t.db.DeleteLoginAttempt(key)
+}
+
+// List returns the keys that are currently throttled or locked
+func (t *PostgresTracker) List() ([]models.LoginAttempt, error) {
+	now := time.Now()
+	candidates, err := t.db.GetLoginAttempts(t.policy.FreeAttempts+1, now.Add(-t.policy.FailureWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := []models.LoginAttempt{}
+	for _, attempt := range candidates {
+		if t.policy.isTracked(&attempt, now) {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
+
+// Prune deletes the records whose failures no longer count
+func (t *PostgresTracker) Prune() (int64, error) {
+	return t.db.DeleteStaleLoginAttempts(time.Now().Add(-t.policy.FailureWindow))
+}
+
+// Clear removes a key, lifting any lockout
+func (t *PostgresTracker) Clear(key string) error {
+	return t.db.DeleteLoginAttempt(key)
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes emails to a file, or to the application log when no path is set.
+// It is meant for local development and tests where no SMTP server is available.
+type LogMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+// NewLogMailer creates a mailer that appends every message to path
+func NewLogMailer(path, from string) *LogMailer {
+	return &LogMailer{path: path, from: from}
+}
+
+// Send records the message instead of delivering it
+func (m *LogMailer) Send(msg Message) error {
+	entry := fmt.Sprintf("Date: %s\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n---\n",
+		time.Now().Format(time.RFC3339), m.from, msg.To, msg.Subject, msg.Body)
+
+	if m.path == "" {
+		log.Printf("[MAILER] 📧 %s", entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening mail log: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(entry)
+	return err
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails to users
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New builds the mailer selected by the MAILER environment variable.
+// "smtp" delivers through an SMTP server, anything else falls back to the log mailer.
+func New() Mailer {
+	from := getEnv("MAIL_FROM", "no-reply@obs.local")
+
+	switch strings.ToLower(os.Getenv("MAILER")) {
+	case "smtp":
+		return NewSMTPMailer(
+			getEnv("SMTP_HOST", "localhost"),
+			getEnv("SMTP_PORT", "1025"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			from,
+		)
+	default:
+		return NewLogMailer(os.Getenv("MAIL_LOG_PATH"), from)
+	}
+}
+
+// getEnv fetches environment variables with a default fallback
+func getEnv(key, fallback string) string {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		log.Printf("[WARNING] ⚠️ Missing env: %s, using default: %s", key, fallback)
+		return fallback
+	}
+	return value
+}
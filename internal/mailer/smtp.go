@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a mailer for the given server. Authentication is skipped when username is empty.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{addr: net.JoinHostPort(host, port), auth: auth, from: from}
+}
+
+// Send delivers the message to its recipient
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, m.format(msg)); err != nil {
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	return nil
+}
+
+// format renders the message headers and body as an RFC 5322 email
+func (m *SMTPMailer) format(msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
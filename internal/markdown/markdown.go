@@ -0,0 +1,181 @@
+// Package markdown renders blog content written in Markdown (CommonMark with the GitHub
+// extensions) to sanitized HTML, along with its table of contents and reading statistics.
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"math"
+	"obs/internal/utils"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Version identifies the renderer output. Bump it when rendering changes, so stored
+// HTML is regenerated on the next migration.
+const Version = 3
+
+// wordsPerMinute is the reading speed used for ReadingTime
+const wordsPerMinute = 200
+
+// Heading is an entry of a document's table of contents
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"` // Anchor of the heading in the rendered HTML
+}
+
+// Document is rendered Markdown
+type Document struct {
+	HTML        string
+	TOC         []Heading
+	WordCount   int
+	ReadingTime int // Minutes, rounded up
+}
+
+var (
+	renderer = goldmark.New(
+		goldmark.WithExtensions(
+			extension.Linkify,
+			extension.Strikethrough,
+			extension.TaskList,
+			// The sanitizer drops style attributes, so alignment uses the align attribute
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+		// Raw HTML is passed through and then cleaned by the sanitizer
+		goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+	)
+
+	sanitizer = newSanitizer()
+
+	// textOnly strips all markup, used to count words
+	textOnly = bluemonday.StrictPolicy()
+)
+
+// newSanitizer allows the HTML user generated content may use, plus what the renderer
+// emits for heading anchors, code fence languages and task lists. It follows bluemonday's
+// UGCPolicy, spelled out because UGCPolicy allows any id containing a letter on every
+// element, which would override the anchor pattern and let posts clobber page elements.
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	p.AllowAttrs("dir").Matching(bluemonday.Direction).Globally()
+	p.AllowAttrs("lang").Matching(regexp.MustCompile(`^[a-zA-Z]{2,8}(-[a-zA-Z0-9]{1,8})*$`)).Globally()
+	p.AllowAttrs("title").Matching(bluemonday.Paragraph).Globally()
+
+	p.AllowElements("article", "aside", "figure", "figcaption", "section", "summary", "hgroup",
+		"h1", "h2", "h3", "h4", "h5", "h6", "br", "div", "hr", "p", "span", "wbr",
+		"abbr", "acronym", "cite", "code", "dfn", "em", "mark", "s", "samp", "strong", "sub", "sup", "var",
+		"b", "i", "pre", "small", "strike", "tt", "u", "rp", "rt", "ruby", "del", "ins")
+	p.AllowAttrs("open").Matching(regexp.MustCompile(`(?i)^(|open)$`)).OnElements("details")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("cite").OnElements("blockquote", "q")
+	p.AllowAttrs("cite").Matching(bluemonday.Paragraph).OnElements("del", "ins")
+	p.AllowAttrs("datetime").Matching(bluemonday.ISO8601).OnElements("time", "del", "ins")
+	p.AllowAttrs("dir").Matching(bluemonday.Direction).OnElements("bdi", "bdo")
+	p.AllowLists()
+	p.AllowTables()
+	p.AllowImages()
+
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{M}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[a-zA-Z0-9_+-]+$`)).OnElements("code")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	return p
+}
+
+// Render converts Markdown source to sanitized HTML and collects its headings and statistics
+func Render(source string) (Document, error) {
+	src := []byte(source)
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{seen: map[string]bool{}}))
+	doc := renderer.Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+
+	var buf bytes.Buffer
+	if err := renderer.Renderer().Render(&buf, src, doc); err != nil {
+		return Document{}, err
+	}
+	out := sanitizer.Sanitize(buf.String())
+
+	words := len(strings.Fields(html.UnescapeString(textOnly.Sanitize(out))))
+	return Document{
+		HTML:        out,
+		TOC:         headings(doc, src),
+		WordCount:   words,
+		ReadingTime: int(math.Ceil(float64(words) / wordsPerMinute)),
+	}, nil
+}
+
+// headings lists the headings of a parsed document with their generated anchors
+func headings(doc ast.Node, src []byte) []Heading {
+	toc := []Heading{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		id, _ := heading.AttributeString("id")
+		anchor, _ := id.([]byte)
+		toc = append(toc, Heading{Level: heading.Level, Text: nodeText(heading, src), ID: string(anchor)})
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// nodeText concatenates the text inside a node, dropping inline markup
+func nodeText(n ast.Node, src []byte) string {
+	var b strings.Builder
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := c.(type) {
+		case *ast.Text:
+			b.Write(t.Segment.Value(src))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(t.Value)
+		case *ast.CodeSpan:
+			for child := t.FirstChild(); child != nil; child = child.NextSibling() {
+				if segment, ok := child.(*ast.Text); ok {
+					b.Write(segment.Segment.Value(src))
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// headingIDs generates heading anchors the way blog slugs are made, so non-Latin headings
+// get readable anchors too, numbering repeated headings within a document
+type headingIDs struct {
+	seen map[string]bool
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	base := utils.Slugify(string(value))
+	id := base
+	for i := 1; ids.seen[id]; i++ {
+		id = base + "-" + strconv.Itoa(i)
+	}
+	ids.seen[id] = true
+	return []byte(id)
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.seen[string(value)] = true
+}
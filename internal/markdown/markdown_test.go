@@ -0,0 +1,131 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, source string) Document {
+	t.Helper()
+	doc, err := Render(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestRenderStripsScripts(t *testing.T) {
+	doc := render(t, strings.Join([]string{
+		`<script>alert("inline")</script>`,
+		``,
+		`<img src="x.png" onerror="alert('handler')">`,
+		``,
+		`[link](javascript:alert('href'))`,
+		``,
+		`<a href="javascript:alert('raw')">raw</a>`,
+		``,
+		`<iframe src="https://example.com"></iframe>`,
+		``,
+		`<p style="color:red" class="evil">styled</p>`,
+	}, "\n"))
+
+	for _, banned := range []string{"<script", "alert(", "onerror", "javascript:", "<iframe", "style=", `class="evil"`} {
+		if strings.Contains(doc.HTML, banned) {
+			t.Errorf("rendered HTML contains %q:\n%s", banned, doc.HTML)
+		}
+	}
+	if !strings.Contains(doc.HTML, "styled") {
+		t.Errorf("text of a sanitized element was lost:\n%s", doc.HTML)
+	}
+}
+
+func TestRenderAllowedAttributes(t *testing.T) {
+	doc := render(t, strings.Join([]string{
+		"# Heading",
+		"",
+		"```go",
+		"fmt.Println()",
+		"```",
+		"",
+		"- [x] done",
+		"",
+		"| Left | Right |",
+		"| :--- | ----: |",
+		"| a    | b     |",
+	}, "\n"))
+
+	for _, want := range []string{`<h1 id="heading">`, `<code class="language-go">`, `type="checkbox"`, `checked`, `align="left"`, `align="right"`} {
+		if !strings.Contains(doc.HTML, want) {
+			t.Errorf("rendered HTML lacks %s:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestRenderRejectsAttributesOutsidePatterns(t *testing.T) {
+	doc := render(t, strings.Join([]string{
+		`<h2 id="bad id&quot;onclick">raw heading</h2>`,
+		``,
+		`<code class="evil">x</code>`,
+		``,
+		`<input type="text" value="x">`,
+		``,
+		`<p id="clobber">not a heading</p>`,
+		``,
+		`<table><tr><td align="left onclick">cell</td></tr></table>`,
+	}, "\n"))
+
+	for _, banned := range []string{`id="bad`, `id="clobber"`, `class="evil"`, `type="text"`, `onclick`} {
+		if strings.Contains(doc.HTML, banned) {
+			t.Errorf("rendered HTML contains %s:\n%s", banned, doc.HTML)
+		}
+	}
+}
+
+func TestRenderTableOfContents(t *testing.T) {
+	doc := render(t, strings.Join([]string{
+		"# Introduction",
+		"",
+		"## Setup *quickly*",
+		"",
+		"## Setup *quickly*",
+		"",
+		"### 中文 标题",
+		"",
+		"## `code` in heading",
+	}, "\n"))
+
+	want := []Heading{
+		{Level: 1, Text: "Introduction", ID: "introduction"},
+		{Level: 2, Text: "Setup quickly", ID: "setup-quickly"},
+		{Level: 2, Text: "Setup quickly", ID: "setup-quickly-1"},
+		{Level: 3, Text: "中文 标题", ID: "中文-标题"},
+		{Level: 2, Text: "code in heading", ID: "code-in-heading"},
+	}
+	if !reflect.DeepEqual(doc.TOC, want) {
+		t.Fatalf("table of contents\n got %+v\nwant %+v", doc.TOC, want)
+	}
+	// Anchors survive sanitizing, so the table of contents links to them
+	for _, heading := range want {
+		if !strings.Contains(doc.HTML, `id="`+heading.ID+`"`) {
+			t.Errorf("rendered HTML lacks the anchor %q:\n%s", heading.ID, doc.HTML)
+		}
+	}
+}
+
+func TestRenderWordCount(t *testing.T) {
+	words := strings.TrimSpace(strings.Repeat("word ", 401))
+	doc := render(t, "# Two words\n\n**"+words+"** <span>and&nbsp;more</span>")
+
+	// Markup does not count as words, entities are decoded: 2 + 401 + 2
+	if doc.WordCount != 405 {
+		t.Errorf("word count %d, want 405", doc.WordCount)
+	}
+	if doc.ReadingTime != 3 {
+		t.Errorf("reading time %d minutes, want 3", doc.ReadingTime)
+	}
+
+	if empty := render(t, ""); empty.WordCount != 0 || empty.ReadingTime != 0 || len(empty.TOC) != 0 {
+		t.Errorf("empty document rendered as %+v", empty)
+	}
+}
@@ -2,13 +2,18 @@ package middleware
 
 import (
 	"net/http"
+	"obs/internal/models"
 	"obs/internal/types"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AdminMiddleware checks if the user has the "admin" role
+// AdminMiddleware checks if the user has the "admin" role. When REQUIRE_ADMIN_2FA
+// is "true", admins must also have two-factor authentication enabled.
 func AdminMiddleware() gin.HandlerFunc {
+	require2FA := os.Getenv("REQUIRE_ADMIN_2FA") == "true"
+
 	return func(c *gin.Context) {
 		// Retrieve the role from the context
 		role, exists := c.Get("role")
@@ -20,15 +25,22 @@ func AdminMiddleware() gin.HandlerFunc {
 		}
 
 		// Check if the role is "admin"
-		if role != "admin" {
+		if role != models.RoleAdmin {
 			res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Access denied, admin role required"}
 			c.JSON(http.StatusForbidden, res)
 			c.Abort()
 			return
 		}
 
+		// Enforce the admin 2FA policy
+		if require2FA && !c.GetBool("two_factor_enabled") {
+			res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Access denied, admins must enable two-factor authentication"}
+			c.JSON(http.StatusForbidden, res)
+			c.Abort()
+			return
+		}
+
 		// Continue to the next handler
 		c.Next()
 	}
 }
-
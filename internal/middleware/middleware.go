@@ -1,15 +1,29 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"obs/internal/database"
 	"obs/internal/types"
 	"obs/internal/utils"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware protects routes by verifying the JWT from cookies
-func AuthMiddleware() gin.HandlerFunc {
+// Authentication methods stored under the "auth_method" context key
+const (
+	AuthMethodSession = "session"
+	AuthMethodToken   = "token"
+)
+
+// sessionTouchInterval limits how often a session's or token's last-used time is written
+const sessionTouchInterval = time.Minute
+
+// AuthMiddleware protects routes by verifying either a session JWT (from the
+// auth_token cookie or an Authorization: Bearer header) or a personal access token
+func AuthMiddleware(db database.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Allow public access to sign-in and sign-up routes
 		path := c.Request.URL.Path
@@ -18,31 +32,124 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Get the token from the cookie
-		token, err := c.Cookie("auth_token")
-		if err != nil {
+		// Prefer the Authorization header, falling back to the cookie
+		token := bearerToken(c)
+		if token == "" {
+			token, _ = c.Cookie("auth_token")
+		}
+		if token == "" {
 			res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Authentication required"}
 			c.JSON(http.StatusUnauthorized, res)
 			c.Abort()
 			return
 		}
 
-		// Verify the JWT token
-		claims, err := utils.VerifyJWT(token)
-		if err != nil {
-			res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid or expired session"}
-			c.JSON(http.StatusUnauthorized, res)
+		var ok bool
+		if strings.HasPrefix(token, utils.PersonalAccessTokenPrefix) {
+			ok = authenticateAccessToken(c, db, token)
+		} else {
+			ok = authenticateSession(c, db, token)
+		}
+		if !ok {
 			c.Abort()
 			return
 		}
 
-		// Store the user details in the context for later use
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
-
 		// Continue to the next handler
 		c.Next()
 	}
 }
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateSession verifies a session JWT and checks that its session has not been revoked
+func authenticateSession(c *gin.Context, db database.Service, token string) bool {
+	// Verify the JWT token
+	claims, err := utils.VerifyJWT(token)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid or expired session"}
+		c.JSON(http.StatusUnauthorized, res)
+		return false
+	}
+
+	// Make sure the session backing the token is still active
+	session, err := db.GetSession(claims.SessionID)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return false
+	}
+	if session == nil || session.UserID != claims.UserID || !session.IsActive() {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Session has been revoked"}
+		c.JSON(http.StatusUnauthorized, res)
+		return false
+	}
+	if session.User.IsBanned() {
+		res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Account has been suspended"}
+		c.JSON(http.StatusForbidden, res)
+		return false
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		if err := db.TouchSession(session.ID, c.ClientIP()); err != nil {
+			log.Printf("[AUTH] Failed to update session %d activity: %v", session.ID, err)
+		}
+	}
+
+	// Store the user details in the context for later use
+	c.Set("auth_method", AuthMethodSession)
+	c.Set("user_id", claims.UserID)
+	c.Set("session_id", claims.SessionID)
+	c.Set("username", claims.Username)
+	c.Set("email", claims.Email)
+	c.Set("role", session.User.Role) // Read from the database so role changes apply immediately
+	c.Set("email_verified", session.User.IsEmailVerified())
+	c.Set("two_factor_enabled", session.User.IsTwoFactorEnabled())
+	return true
+}
+
+// authenticateAccessToken looks up a personal access token by its hash and loads its owner
+func authenticateAccessToken(c *gin.Context, db database.Service, token string) bool {
+	pat, err := db.GetPersonalAccessTokenByHash(utils.HashToken(token))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return false
+	}
+	if pat == nil || !pat.IsActive() {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid or expired access token"}
+		c.JSON(http.StatusUnauthorized, res)
+		return false
+	}
+	if pat.User.IsBanned() {
+		res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Account has been suspended"}
+		c.JSON(http.StatusForbidden, res)
+		return false
+	}
+
+	if pat.LastUsedAt == nil || time.Since(*pat.LastUsedAt) > sessionTouchInterval {
+		if err := db.TouchPersonalAccessToken(pat.ID); err != nil {
+			log.Printf("[AUTH] Failed to update access token %d activity: %v", pat.ID, err)
+		}
+	}
+
+	// Store the user details in the context for later use
+	c.Set("auth_method", AuthMethodToken)
+	c.Set("user_id", pat.UserID)
+	c.Set("token_id", pat.ID)
+	c.Set("scopes", pat.ScopeList())
+	c.Set("username", pat.User.Username)
+	c.Set("email", pat.User.Email)
+	c.Set("role", pat.User.Role)
+	c.Set("email_verified", pat.User.IsEmailVerified())
+	c.Set("two_factor_enabled", pat.User.IsTwoFactorEnabled())
+	return true
+}
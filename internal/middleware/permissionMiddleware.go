@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"obs/internal/database"
+	"obs/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission only lets users through whose role grants the given permission
+func RequirePermission(db database.Service, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if role == "" {
+			res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Role not found"}
+			c.JSON(http.StatusUnauthorized, res)
+			c.Abort()
+			return
+		}
+
+		allowed, err := db.RoleHasPermission(role, permission)
+		if err != nil {
+			res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+			c.JSON(http.StatusInternalServerError, res)
+			c.Abort()
+			return
+		}
+		if !allowed {
+			res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Access denied, missing the " + permission + " permission"}
+			c.JSON(http.StatusForbidden, res)
+			c.Abort()
+			return
+		}
+
+		// Continue to the next handler
+		c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"obs/internal/types"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope only lets personal access tokens through if they carry the given scope.
+// Session logins are not scoped and always pass.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") != AuthMethodToken {
+			c.Next()
+			return
+		}
+
+		if !slices.Contains(c.GetStringSlice("scopes"), scope) {
+			res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Access denied, token is missing the " + scope + " scope"}
+			c.JSON(http.StatusForbidden, res)
+			c.Abort()
+			return
+		}
+
+		// Continue to the next handler
+		c.Next()
+	}
+}
+
+// RequireSession rejects personal access tokens for account-sensitive routes
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") != AuthMethodSession {
+			res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Access denied, this action requires an interactive login"}
+			c.JSON(http.StatusForbidden, res)
+			c.Abort()
+			return
+		}
+
+		// Continue to the next handler
+		c.Next()
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"obs/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail blocks users who have not confirmed their email address yet
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("email_verified") {
+			res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Please verify your email address first"}
+			c.JSON(http.StatusForbidden, res)
+			c.Abort()
+			return
+		}
+
+		// Continue to the next handler
+		c.Next()
+	}
+}
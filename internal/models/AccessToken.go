@@ -0,0 +1,54 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes that can be granted to a personal access token
+const (
+	ScopeBlogWrite       = "blog:write"
+	ScopeCommentWrite    = "comment:write"
+	ScopeEngagementWrite = "engagement:write" // Follows, likes and views
+	ScopeModeration      = "moderation"
+	ScopeAdmin           = "admin"
+)
+
+// ValidScopes lists every scope a personal access token may carry
+var ValidScopes = []string{ScopeBlogWrite, ScopeCommentWrite, ScopeEngagementWrite, ScopeModeration, ScopeAdmin}
+
+// PersonalAccessToken is a long-lived, scoped API token stored as a hash
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"`
+	Scopes     string     `gorm:"type:text;not null;default:''" json:"-"` // Space separated list of scopes
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// ScopeList returns the scopes granted to the token
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// HasScope reports whether the token was granted the given scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.ScopeList(), scope)
+}
+
+// IsActive reports whether the token is neither revoked nor expired
+func (t *PersonalAccessToken) IsActive() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
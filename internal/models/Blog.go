@@ -1,21 +1,111 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 )
 
+// Blog lifecycle states
+const (
+	BlogStatusDraft     = "draft"
+	BlogStatusScheduled = "scheduled"
+	BlogStatusPublished = "published"
+	BlogStatusArchived  = "archived"
+)
+
 // Blog model with validation
 type Blog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Title      string    `gorm:"size:225;not null" json:"title" validate:"required,min=3,max=225"`
+	Content    string    `gorm:"type:text;not null" json:"content" validate:"required,min=10"`
+	UserID     uint      `gorm:"not null;index" json:"user_id" validate:"required"`
+	Author     string    `gorm:"not null;" json:"author" validate:"required"`
+	Slug       string    `gorm:"size:255;uniqueIndex" json:"slug"` // Assigned from the title, see database.CreateBlog
+	CategoryID *uint     `gorm:"index" json:"category_id"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Lifecycle, the column default keeps posts written before drafts existed public
+	Status      string     `gorm:"size:20;not null;default:'published';index" json:"status"`
+	PublishedAt *time.Time `gorm:"index" json:"published_at"`
+	ScheduledAt *time.Time `gorm:"index" json:"scheduled_at"`
+
+	// Content rendered from Markdown, regenerated whenever the content changes
+	ContentHTML     string          `gorm:"type:text;not null;default:''" json:"content_html"`
+	TOC             TableOfContents `gorm:"type:jsonb;not null;default:'[]'" json:"toc"`
+	WordCount       int             `gorm:"not null;default:0" json:"word_count"`
+	ReadingTime     int             `gorm:"not null;default:0" json:"reading_time"` // Minutes
+	RenderedVersion int             `gorm:"not null;default:0" json:"-"`            // Renderer version of ContentHTML
+
+	// Moderation mode of comments on the blog, applied when stricter than the site's
+	CommentModeration string `gorm:"size:20;not null;default:'off'" json:"comment_moderation"`
+
+	// Cover image renditions by name, e.g. "256", to URL
+	Cover Renditions `gorm:"type:jsonb;not null;default:'{}'" json:"cover"`
+
+	// Engagement counters, updated in the same transaction as the rows they count
+	LikesCount    int64 `gorm:"not null;default:0" json:"likes_count"`
+	CommentsCount int64 `gorm:"not null;default:0" json:"comments_count"`
+	ViewsCount    int64 `gorm:"not null;default:0" json:"views_count"`
+
+	// Relationships
+	User      User           `gorm:"foreignKey:UserID" json:"-"`
+	Comments  []Comment      `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"comments,omitempty"`
+	Likes     []Like         `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"likes,omitempty"`
+	Views     []View         `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"views,omitempty"` // Add this line for Views
+	OldSlugs  []BlogSlug     `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"-"`
+	Revisions []BlogRevision `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"-"`
+	Media     []Media        `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"-"`
+	Tags      []Tag          `gorm:"many2many:blog_tags;constraint:OnDelete:CASCADE;" json:"tags"`
+	Category  *Category      `gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL;" json:"category,omitempty"`
+}
+
+// BlogSlug is a slug a blog was previously reachable under, kept so old links redirect
+type BlogSlug struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Title     string    `gorm:"size:225;not null" json:"title" validate:"required,min=3,max=225"`
-	Content   string    `gorm:"type:text;not null" json:"content" validate:"required,min=10"`
-	UserID    uint      `gorm:"not null;index" json:"user_id" validate:"required"`
-	Author    string    `gorm:"not null;" json:"author" validate:"required"`
+	BlogID    uint      `gorm:"not null;index" json:"blog_id"`
+	Slug      string    `gorm:"size:255;not null;uniqueIndex" json:"slug"`
 	CreatedAt time.Time `json:"created_at"`
 
-	// Relationships
-	User     User      `gorm:"foreignKey:UserID" json:"-"`
-	Comments []Comment `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"comments"`
-	Likes    []Like    `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"likes"`
-	Views    []View    `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"views"` // Add this line for Views
+	Blog Blog `gorm:"foreignKey:BlogID" json:"-"`
+}
+
+// IsPublished reports whether the blog is publicly visible
+func (b *Blog) IsPublished() bool {
+	return b.Status == BlogStatusPublished
+}
+
+// TOCEntry is a heading of a blog's content
+type TOCEntry struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"` // Anchor of the heading in ContentHTML
+}
+
+// TableOfContents lists the headings of a blog's content, stored as JSON
+type TableOfContents []TOCEntry
+
+// Value implements driver.Valuer
+func (t TableOfContents) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner
+func (t *TableOfContents) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	default:
+		return errors.New("unsupported table of contents value")
+	}
 }
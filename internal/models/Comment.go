@@ -4,16 +4,51 @@ import (
 	"time"
 )
 
-// Comment model with validation
+// CommentTombstone replaces the author and content of a deleted comment that still has
+// replies, so the discussion under it stays in place
+const CommentTombstone = "[deleted]"
+
+// Comment model with validation. Replies point at the comment they answer with ParentID;
+// Depth counts the ancestors, so top-level comments have depth 0.
 type Comment struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Content   string    `gorm:"type:text;not null" json:"content" validate:"required,min=3"`
 	Author    string    `gorm:"type:text;not null" json:"author" validate:"required"`
-	UserID    uint      `gorm:"not null;index" json:"user_id" validate:"required"`
+	UserID    *uint     `gorm:"index" json:"user_id"` // Nil once the comment is deleted
 	BlogID    uint      `gorm:"not null;index" json:"blog_id" validate:"required"`
 	CreatedAt time.Time `json:"created_at"`
 
+	// Threading
+	ParentID     *uint      `gorm:"index" json:"parent_id"`
+	Depth        int        `gorm:"not null;default:0" json:"depth"`
+	RepliesCount int64      `gorm:"not null;default:0" json:"replies_count"` // Direct replies, tombstones included
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`                    // Set when the comment became a tombstone
+
+	// Moderation, the column default keeps comments written before moderation existed public
+	Status    string `gorm:"size:20;not null;default:'approved';index" json:"status"`
+	SpamLabel string `gorm:"size:10;not null;default:''" json:"-"` // Label the spam classifier was trained with, if any
+
 	// Relationships
-	User User `gorm:"foreignKey:UserID" json:"-"`
-	Blog Blog `gorm:"foreignKey:BlogID" json:"-"`
+	User      *User             `gorm:"foreignKey:UserID" json:"-"`
+	Blog      Blog              `gorm:"foreignKey:BlogID" json:"-"`
+	Replies   []Comment         `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE;" json:"-"`
+	Decisions []CommentDecision `gorm:"foreignKey:CommentID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// IsDeleted reports whether the comment is a tombstone
+func (c *Comment) IsDeleted() bool {
+	return c.DeletedAt != nil
+}
+
+// IsApproved reports whether the comment is shown to everyone
+func (c *Comment) IsApproved() bool {
+	return c.Status == CommentStatusApproved
+}
+
+// OwnerID returns the ID of the comment's author, or 0 for tombstones
+func (c *Comment) OwnerID() uint {
+	if c.UserID == nil {
+		return 0
+	}
+	return *c.UserID
 }
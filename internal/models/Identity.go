@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// Identity links a user to an account at an external OpenID Connect provider
+type Identity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:50;not null;uniqueIndex:provider_subject_unique" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:provider_subject_unique" json:"-"`
+	Email     string    `gorm:"size:100" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
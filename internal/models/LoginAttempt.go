@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt tracks consecutive failed logins for an account or client IP
+type LoginAttempt struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Key           string     `gorm:"size:255;not null;uniqueIndex" json:"key"` // e.g. "account:jane@example.com" or "ip:203.0.113.7"
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
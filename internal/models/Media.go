@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Kinds of uploaded media
+const (
+	MediaKindAvatar = "avatar" // Profile picture, replaced by the next avatar upload
+	MediaKindCover  = "cover"  // Cover image of a blog, replaced by the next cover upload
+	MediaKindImage  = "image"  // Image embedded in blog posts
+)
+
+// Media processing states. Avatars and covers are pending until their renditions are
+// made, and processing while a processor holds them; other uploads are ready right away.
+const (
+	MediaStatusPending    = "pending"
+	MediaStatusProcessing = "processing"
+	MediaStatusReady      = "ready"
+	MediaStatusFailed     = "failed"
+)
+
+// Media is a file a user uploaded. The bytes live in the storage backend under Key;
+// Size counts against the owner's quota.
+type Media struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	BlogID      *uint     `gorm:"index" json:"blog_id,omitempty"` // Blog a cover belongs to
+	Kind        string    `gorm:"size:20;not null" json:"kind"`
+	Key         string    `gorm:"size:255;not null;uniqueIndex" json:"-"`
+	ContentType string    `gorm:"size:100;not null" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Processing, see the imaging package. Once renditions exist the original upload,
+	// which may carry EXIF and GPS metadata, is deleted.
+	Status     string     `gorm:"size:20;not null;default:'ready';index" json:"status"`
+	Error      string     `gorm:"type:text;not null;default:''" json:"error,omitempty"`
+	Width      int        `gorm:"not null;default:0" json:"width,omitempty"`
+	Height     int        `gorm:"not null;default:0" json:"height,omitempty"`
+	Renditions Renditions `gorm:"type:jsonb;not null;default:'{}'" json:"-"` // Rendition name to storage key
+	Attempts   int        `gorm:"not null;default:0" json:"-"`               // Times a processor claimed it, numbering the claims
+	ClaimedAt  *time.Time `json:"-"`                                         // When the current claim was made
+
+	// Relationships
+	User User  `gorm:"foreignKey:UserID" json:"-"`
+	Blog *Blog `gorm:"foreignKey:BlogID" json:"-"`
+}
+
+// StorageKeys lists the stored files of the upload: the original and its renditions
+func (m *Media) StorageKeys() []string {
+	keys := []string{m.Key}
+	for _, key := range m.Renditions {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Renditions maps rendition names, such as "256", to a storage key or URL, stored as JSON
+type Renditions map[string]string
+
+// Value implements driver.Valuer
+func (r Renditions) Value() (driver.Value, error) {
+	if r == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(r)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner
+func (r *Renditions) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return errors.New("unsupported renditions value")
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Comment moderation states. Only approved comments are shown to other users; commenters
+// still see their own comments in any state.
+const (
+	CommentStatusPending  = "pending"
+	CommentStatusApproved = "approved"
+	CommentStatusRejected = "rejected"
+	CommentStatusHidden   = "hidden"
+)
+
+// CommentStatuses lists every moderation state of a comment
+var CommentStatuses = []string{CommentStatusPending, CommentStatusApproved, CommentStatusRejected, CommentStatusHidden}
+
+// Moderation modes, deciding which new comments are held for a moderator
+const (
+	ModerationOff       = "off"        // Comments are published right away
+	ModerationFirstTime = "first_time" // Comments from users without an approved comment are held
+	ModerationAll       = "all"        // Every comment is held
+)
+
+// ModerationModes lists every moderation mode, from least to most strict
+var ModerationModes = []string{ModerationOff, ModerationFirstTime, ModerationAll}
+
+// ModerationSettings are the site-wide moderation settings, stored in a single row.
+// Blogs can moderate more strictly than the site, but not less.
+type ModerationSettings struct {
+	ID                uint      `gorm:"primaryKey" json:"-"`
+	CommentModeration string    `gorm:"size:20;not null;default:'off'" json:"comment_moderation"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// CommentDecision records a change of a comment's moderation state and why it was made
+type CommentDecision struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CommentID   uint      `gorm:"not null;index" json:"comment_id"`
+	ModeratorID *uint     `gorm:"index" json:"moderator_id"` // Nil for decisions made when the comment was posted
+	FromStatus  string    `gorm:"size:20;not null;default:''" json:"from_status"`
+	Status      string    `gorm:"size:20;not null" json:"status"`
+	Reason      string    `gorm:"type:text;not null;default:''" json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Relationships
+	Comment   Comment `gorm:"foreignKey:CommentID" json:"-"`
+	Moderator *User   `gorm:"foreignKey:ModeratorID" json:"-"`
+}
+
+// IsValidCommentStatus reports whether status is one of the comment moderation states
+func IsValidCommentStatus(status string) bool {
+	return slices.Contains(CommentStatuses, status)
+}
+
+// IsValidModerationMode reports whether mode is one of the moderation modes
+func IsValidModerationMode(mode string) bool {
+	return slices.Contains(ModerationModes, mode)
+}
+
+// StricterModeration returns the stricter of two moderation modes
+func StricterModeration(a, b string) string {
+	if slices.Index(ModerationModes, b) > slices.Index(ModerationModes, a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordReset stores the hash of a single-use password reset token
+type PasswordReset struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
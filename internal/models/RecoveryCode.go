@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a hashed one-time code that can replace a TOTP code
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// BlogRevision is a saved version of a blog's title and content. Number counts the
+// versions of each blog from 1, the highest one matches the current content.
+type BlogRevision struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	BlogID       uint      `gorm:"not null;uniqueIndex:blog_revision_number" json:"blog_id"`
+	Number       int       `gorm:"not null;uniqueIndex:blog_revision_number" json:"number"`
+	Title        string    `gorm:"size:225;not null" json:"title"`
+	Content      string    `gorm:"type:text;not null" json:"content,omitempty"`
+	EditorID     *uint     `gorm:"index" json:"editor_id"`  // Nil once the editor's account is deleted
+	RestoredFrom *int      `json:"restored_from,omitempty"` // Number of the revision this one restored
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Relationships
+	Blog   Blog  `gorm:"foreignKey:BlogID" json:"-"`
+	Editor *User `gorm:"foreignKey:EditorID" json:"-"`
+}
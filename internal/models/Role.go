@@ -0,0 +1,56 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Roles a user can hold
+const (
+	RoleAuthor    = "author"
+	RoleEditor    = "editor"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every valid role, from least to most privileged
+var Roles = []string{RoleAuthor, RoleEditor, RoleModerator, RoleAdmin}
+
+// Permissions that can be granted to a role
+const (
+	PermBlogPublish      = "blog.publish"
+	PermBlogEditAny      = "blog.edit_any"
+	PermBlogDeleteAny    = "blog.delete_any"
+	PermCommentModerate  = "comment.moderate"
+	PermCommentDeleteAny = "comment.delete_any"
+	PermUserBan          = "user.ban"
+)
+
+// Permissions lists every permission a role may be granted
+var Permissions = []string{PermBlogPublish, PermBlogEditAny, PermBlogDeleteAny, PermCommentModerate, PermCommentDeleteAny, PermUserBan}
+
+// DefaultRolePermissions is seeded into the role_permissions table when it is first created.
+// Admins hold every permission implicitly and are not listed.
+var DefaultRolePermissions = map[string][]string{
+	RoleAuthor:    {PermBlogPublish},
+	RoleEditor:    {PermBlogPublish, PermBlogEditAny},
+	RoleModerator: {PermBlogPublish, PermCommentModerate, PermCommentDeleteAny, PermUserBan},
+}
+
+// RolePermission grants a permission to every user with the role
+type RolePermission struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Role       string    `gorm:"size:50;not null;uniqueIndex:role_permission_unique" json:"role"`
+	Permission string    `gorm:"size:100;not null;uniqueIndex:role_permission_unique" json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// IsValidRole reports whether role is one of the known roles
+func IsValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// IsValidPermission reports whether permission is one of the known permissions
+func IsValidPermission(permission string) bool {
+	return slices.Contains(Permissions, permission)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents a single login backed by a chain of rotating refresh tokens
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	UserAgent  string     `gorm:"type:text" json:"user_agent"`
+	IP         string     `gorm:"size:64" json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	User          User           `gorm:"foreignKey:UserID" json:"-"`
+	RefreshTokens []RefreshToken `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// IsActive reports whether the session can still be used to authenticate
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RefreshToken stores the hash of a single-use refresh token belonging to a session
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	SessionID uint       `gorm:"not null;index" json:"session_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	Session Session `gorm:"foreignKey:SessionID" json:"-"`
+}
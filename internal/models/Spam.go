@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Labels a comment can be trained with, see Comment.SpamLabel
+const (
+	SpamLabelSpam = "spam"
+	SpamLabelHam  = "ham" // Not spam
+)
+
+// SpamToken counts the trained comments a token appeared in, by label, for the spam
+// classifier
+type SpamToken struct {
+	Token     string    `gorm:"primaryKey;size:100" json:"token"`
+	Spam      int64     `gorm:"not null;default:0" json:"spam"`
+	Ham       int64     `gorm:"not null;default:0" json:"ham"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SpamCorpus counts the trained comments by label, stored in a single row
+type SpamCorpus struct {
+	ID   uint  `gorm:"primaryKey" json:"-"`
+	Spam int64 `gorm:"not null;default:0" json:"spam"`
+	Ham  int64 `gorm:"not null;default:0" json:"ham"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Tag is a free-form topic attached to blogs
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:50;not null" json:"name" validate:"required,max=50"`
+	Slug      string    `gorm:"size:80;not null;uniqueIndex" json:"slug"` // Fits the longest slug utils.TopicSlug makes
+	CreatedAt time.Time `json:"created_at"`
+
+	// Number of published blogs with the tag, only filled by tag listings
+	BlogCount int64 `gorm:"->;-:migration" json:"blog_count"`
+
+	// Relationships
+	Blogs []Blog `gorm:"many2many:blog_tags;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Category is a curated topic; categories form a tree through ParentID
+type Category struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+	Slug        string    `gorm:"size:120;not null;uniqueIndex" json:"slug"`
+	Description string    `gorm:"type:text;not null;default:''" json:"description"`
+	ParentID    *uint     `gorm:"index" json:"parent_id"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Relationships
+	Parent   *Category  `gorm:"foreignKey:ParentID" json:"-"`
+	Children []Category `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT;" json:"children,omitempty"`
+	Blogs    []Blog     `gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL;" json:"-"`
+}
@@ -11,17 +11,67 @@ type User struct {
 	Email     string    `gorm:"size:100;uniqueIndex;not null"`
 	Pfp       string    `gorm:"type:text;not null;default:'https://static.vecteezy.com/system/resources/thumbnails/020/765/399/small_2x/default-profile-account-unknown-icon-black-silhouette-free-vector.jpg'" json:"pfp" validate:"required"`
 	Password  string    `gorm:"type:text;not null" json:"password" validate:"required,min=6"`
-	Role      string    `gorm:"size:50;not null;default:'author'" json:"role" validate:"required,oneof=author admin"`
+	Role      string    `gorm:"size:50;not null;default:'author'" json:"role" validate:"required,oneof=author editor moderator admin"`
 	CreatedAt time.Time `json:"created_at"`
 
+	// Renditions of an uploaded avatar by name, e.g. "64", to URL; empty while Pfp is external
+	PfpRenditions Renditions `gorm:"type:jsonb;not null;default:'{}'" json:"pfp_renditions"`
+
+	// When the user chose a password. Accounts created through a login provider get an
+	// unusable random one and have none until they set it through a password reset.
+	PasswordSetAt *time.Time `json:"-"`
+
+	// Email verification
+	EmailVerifiedAt    *time.Time `json:"-"`
+	VerificationSentAt *time.Time `json:"-"`
+
+	// Two-factor authentication
+	TOTPSecret    string     `gorm:"size:64" json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	TOTPLastStep  int64      `gorm:"not null;default:0" json:"-"` // Last accepted TOTP time step, prevents code replay
+
+	// Suspension
+	BannedAt  *time.Time `json:"-"`
+	BanReason string     `gorm:"type:text;not null;default:''" json:"-"`
+
+	// Engagement counters, updated in the same transaction as the follows they count
+	FollowersCount int64 `gorm:"not null;default:0" json:"followers_count"`
+	FollowingCount int64 `gorm:"not null;default:0" json:"following_count"`
+
 	// Relationships
-	Blogs    []Blog    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
-	Comments []Comment `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
-	Likes    []Like    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
-	Views    []View    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Blogs         []Blog                `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Comments      []Comment             `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL;"` // Comments with replies outlive their author as tombstones
+	Likes         []Like                `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Views         []View                `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Sessions      []Session             `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Tokens        []PersonalAccessToken `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	RecoveryCodes []RecoveryCode        `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Revisions     []BlogRevision        `gorm:"foreignKey:EditorID;constraint:OnDelete:SET NULL;" json:"-"`
+	Media         []Media               `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Decisions     []CommentDecision     `gorm:"foreignKey:ModeratorID;constraint:OnDelete:SET NULL;" json:"-"`
 	// Followers - Users who follow this user
 	Followers []User `gorm:"many2many:follows;joinForeignKey:FollowedID;JoinReferences:FollowerID"`
 
 	// Following - Users this user follows
 	Following []User `gorm:"many2many:follows;joinForeignKey:FollowerID;JoinReferences:FollowedID"`
 }
+
+// IsEmailVerified reports whether the user has confirmed their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// HasPassword reports whether the user can log in with a password of their own
+func (u *User) HasPassword() bool {
+	return u.PasswordSetAt != nil
+}
+
+// IsTwoFactorEnabled reports whether the user has finished TOTP enrollment
+func (u *User) IsTwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// IsBanned reports whether the account has been suspended
+func (u *User) IsBanned() bool {
+	return u.BannedAt != nil
+}
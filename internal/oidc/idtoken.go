@@ -0,0 +1,76 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDTokenClaims are the ID token claims used to identify and provision users
+type IDTokenClaims struct {
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// VerifyIDToken checks the ID token's signature against the provider's JWKS and
+// validates its issuer, audience, expiry and nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	discovery, err := p.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return keys.get(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying id_token: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id_token nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	return claims, nil
+}
+
+// flexBool accepts both JSON booleans and the "true"/"false" strings some providers send
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case bool:
+		*b = flexBool(value)
+	case string:
+		*b = flexBool(value == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
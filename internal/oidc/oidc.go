@@ -0,0 +1,62 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Registry holds the configured identity providers keyed by name
+type Registry map[string]*Provider
+
+// Load reads the providers listed in OIDC_PROVIDERS (comma separated names). Each
+// provider NAME is configured with OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL and optionally OIDC_<NAME>_SCOPES.
+func Load() Registry {
+	registry := Registry{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			log.Printf("[WARNING] ⚠️ OIDC provider %s is missing its issuer, client ID or redirect URL, skipping", name)
+			continue
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = []string{"openid", "email", "profile"}
+		}
+
+		registry[name] = NewProvider(config)
+	}
+	return registry
+}
+
+// Names returns the configured provider names in alphabetical order
+func (r Registry) Names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CodeChallenge derives the S256 PKCE code challenge from a code verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,178 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryTTL controls how long a fetched discovery document is reused
+const discoveryTTL = time.Hour
+
+// Config describes a single OpenID Connect identity provider
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Discovery holds the parts of the provider's discovery document that the login flow needs
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// TokenResponse is the token endpoint's answer to an authorization code exchange
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Provider runs the authorization code flow against one identity provider
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *Discovery
+	discoveryAt time.Time
+	keys        *keySet
+}
+
+// NewProvider creates a provider client. The discovery document is fetched lazily on first use.
+func NewProvider(config Config) *Provider {
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the name the provider was configured under
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL builds the URL the user is redirected to in order to sign in at the provider
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.Discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange trades an authorization code and its PKCE verifier for tokens
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*TokenResponse, error) {
+	discovery, err := p.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var token TokenResponse
+	if err := p.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("error exchanging code: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response did not contain an id_token")
+	}
+	return &token, nil
+}
+
+// Discovery returns the provider's discovery document, fetching it if the cached copy is stale
+func (p *Provider) Discovery(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && time.Since(p.discoveryAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery Discovery
+	if err := p.doJSON(req, &discovery); err != nil {
+		return nil, fmt.Errorf("error fetching discovery document: %w", err)
+	}
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", discovery.Issuer, p.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	if p.keys == nil || p.keys.uri != discovery.JWKSURI {
+		p.keys = newKeySet(discovery.JWKSURI, p.client)
+	}
+	p.discovery = &discovery
+	p.discoveryAt = time.Now()
+	return p.discovery, nil
+}
+
+// doJSON sends the request and decodes a successful JSON response into v
+func (p *Provider) doJSON(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,295 @@
+// Package pagination parses the shared list query parameters (limit, cursor, sort, order and
+// filters) and applies keyset pagination to gorm queries.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"obs/internal/types"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultLimit is the page size when ?limit= is not given
+	DefaultLimit = 20
+	// MaxLimit caps ?limit=
+	MaxLimit = 100
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or were issued for another sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Kind is the type of a sort or filter value
+type Kind int
+
+const (
+	Time Kind = iota
+	Int
+	String
+)
+
+// Sort is an SQL expression a list can be ordered by. The expression must not be NULL,
+// wrap nullable columns in COALESCE.
+type Sort struct {
+	Expr string
+	Kind Kind
+}
+
+// Filter maps a query parameter to the column it compares for equality
+type Filter struct {
+	Param  string
+	Column string
+	Kind   Kind
+}
+
+// Spec describes what a list endpoint can be sorted and filtered by
+type Spec struct {
+	Table       string // Table whose id breaks ties between equal sort values
+	Sorts       map[string]Sort
+	DefaultSort string
+	Ascending   bool // Order ascending when ?order= is not given
+	Filters     []Filter
+}
+
+// Query is a validated list request, built with Parse or New
+type Query struct {
+	Limit int
+	Sort  string
+	Desc  bool
+
+	spec    Spec
+	filters []filterValue
+	cursor  *cursor
+}
+
+type filterValue struct {
+	column string
+	value  any
+}
+
+// cursor is the position after the last row of a page, encoded as base64 JSON
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value any    `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// New returns the query for the first page of a list in its default order, for lists
+// that are not read from request parameters
+func New(spec Spec, limit int) Query {
+	return Query{Limit: limit, Sort: spec.DefaultSort, Desc: !spec.Ascending, spec: spec}
+}
+
+// Parse reads ?limit=, ?cursor=, ?sort=, ?order= (asc or desc, default desc unless the spec
+// is ascending) and the spec's filters from the request
+func Parse(c *gin.Context, spec Spec) (Query, error) {
+	q := New(spec, DefaultLimit)
+	defaultOrder := "desc"
+	if spec.Ascending {
+		defaultOrder = "asc"
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return q, fmt.Errorf("limit must be a positive integer")
+		}
+		q.Limit = min(limit, MaxLimit)
+	}
+
+	if v := c.Query("sort"); v != "" {
+		if _, ok := spec.Sorts[v]; !ok {
+			return q, fmt.Errorf("unsupported sort %q", v)
+		}
+		q.Sort = v
+	}
+
+	switch c.DefaultQuery("order", defaultOrder) {
+	case "desc":
+		q.Desc = true
+	case "asc":
+		q.Desc = false
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	for _, filter := range spec.Filters {
+		raw := c.Query(filter.Param)
+		if raw == "" {
+			continue
+		}
+		value, err := parseValue(raw, filter.Kind)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s: %w", filter.Param, err)
+		}
+		q.filters = append(q.filters, filterValue{column: filter.Column, value: value})
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cur, err := q.decodeCursor(v)
+		if err != nil {
+			return q, err
+		}
+		q.cursor = cur
+	}
+
+	return q, nil
+}
+
+// Filter applies the requested filters. It is what the total count is computed over.
+func (q Query) Filter(db *gorm.DB) *gorm.DB {
+	for _, filter := range q.filters {
+		db = db.Where(filter.column+" = ?", filter.value)
+	}
+	return db
+}
+
+// page applies the filters, the cursor position, the ordering and the limit. One row more
+// than the limit is fetched to know whether there is a next page.
+func (q Query) page(db *gorm.DB) *gorm.DB {
+	sort := q.spec.Sorts[q.Sort]
+	id := q.spec.Table + ".id"
+	direction, comparison := "DESC", "<"
+	if !q.Desc {
+		direction, comparison = "ASC", ">"
+	}
+
+	db = db.Scopes(q.Filter)
+	if q.cursor != nil {
+		db = db.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", sort.Expr, id, comparison), q.cursor.Value, q.cursor.ID)
+	}
+	return db.Order(fmt.Sprintf("%s %s, %s %s", sort.Expr, direction, id, direction)).Limit(q.Limit + 1)
+}
+
+// Find loads one page of db into dest and returns the page metadata. db should select the
+// spec's table with any visibility conditions applied; scopes such as preloads and extra
+// selected columns only apply to the page, not the total count.
+// Rows must have an ID field, as every model does.
+func Find[T any](db *gorm.DB, q Query, dest *[]T, scopes ...func(*gorm.DB) *gorm.DB) (*types.Meta, error) {
+	meta := &types.Meta{Limit: q.Limit, Sort: q.Sort, Order: "desc"}
+	if !q.Desc {
+		meta.Order = "asc"
+	}
+
+	if err := db.Session(&gorm.Session{}).Scopes(q.Filter).Count(&meta.Total).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Session(&gorm.Session{}).Scopes(scopes...).Scopes(q.page).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	if len(*dest) > q.Limit {
+		*dest = (*dest)[:q.Limit]
+		last := reflect.ValueOf((*dest)[q.Limit-1]).FieldByName("ID").Uint()
+		next, err := q.nextCursor(db, uint(last))
+		if err != nil {
+			return nil, err
+		}
+		meta.NextCursor = next
+	}
+	return meta, nil
+}
+
+// nextCursor reads the sort value of the last row of a page and encodes the position after it
+func (q Query) nextCursor(db *gorm.DB, lastID uint) (string, error) {
+	sort := q.spec.Sorts[q.Sort]
+	row := db.Session(&gorm.Session{NewDB: true}).
+		Table(q.spec.Table).
+		Select(sort.Expr).
+		Where(q.spec.Table+".id = ?", lastID).
+		Row()
+
+	var value any
+	switch sort.Kind {
+	case Time:
+		var t time.Time
+		if err := row.Scan(&t); err != nil {
+			return "", err
+		}
+		value = t
+	case Int:
+		var n int64
+		if err := row.Scan(&n); err != nil {
+			return "", err
+		}
+		value = n
+	default:
+		var s string
+		if err := row.Scan(&s); err != nil {
+			return "", err
+		}
+		value = s
+	}
+	return q.CursorAfter(value, lastID)
+}
+
+// CursorAfter encodes the position after the row with the given sort value and ID, for
+// lists whose rows were loaded without Find
+func (q Query) CursorAfter(value any, id uint) (string, error) {
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC().Format(time.RFC3339Nano)
+	}
+	raw, err := json.Marshal(cursor{Sort: q.Sort, Desc: q.Desc, Value: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor checks a cursor belongs to the requested sort and converts its value back
+func (q Query) decodeCursor(encoded string) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cur cursor
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cur.Sort != q.Sort || cur.Desc != q.Desc {
+		return nil, fmt.Errorf("%w: it was issued for another sort order", ErrInvalidCursor)
+	}
+
+	var value string
+	switch v := cur.Value.(type) {
+	case string:
+		value = v
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, ErrInvalidCursor
+	}
+	if cur.Value, err = parseValue(value, q.spec.Sorts[q.Sort].Kind); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cur, nil
+}
+
+// parseValue converts a query parameter or cursor value to the Go type of its kind
+func parseValue(raw string, kind Kind) (any, error) {
+	switch kind {
+	case Time:
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be an RFC 3339 time")
+		}
+		return t, nil
+	case Int:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return n, nil
+	default:
+		return raw, nil
+	}
+}
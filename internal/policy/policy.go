@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"obs/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionChecker resolves whether a role grants a permission
+type PermissionChecker interface {
+	RoleHasPermission(role, permission string) (bool, error)
+}
+
+// Actor is the authenticated user a request is made on behalf of
+type Actor struct {
+	UserID uint
+	Role   string
+}
+
+// ActorFromContext builds the actor from the claims AuthMiddleware stored in the context
+func ActorFromContext(c *gin.Context) (Actor, bool) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		return Actor{}, false
+	}
+	return Actor{UserID: userID, Role: c.GetString("role")}, true
+}
+
+// Decision is the outcome of a policy check. Reason explains a denial to the client.
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// Policy decides which actors may act on which resources. Owners may always act on
+// their own resources; anyone else needs a role with the matching permission.
+type Policy struct {
+	perms PermissionChecker
+}
+
+// New creates a policy that looks up role permissions with perms
+func New(perms PermissionChecker) *Policy {
+	return &Policy{perms: perms}
+}
+
+// CanViewBlog allows anyone to see published blogs; drafts, scheduled and archived
+// blogs are only visible to the author and roles with blog.edit_any
+func (p *Policy) CanViewBlog(actor Actor, blog *models.Blog) (Decision, error) {
+	if blog.IsPublished() {
+		return Decision{Allowed: true}, nil
+	}
+	return p.ownerOr(actor, blog.UserID, models.PermBlogEditAny, "this blog is not published")
+}
+
+// CanPublishBlog allows roles with blog.publish to change the lifecycle of their own
+// blogs, or of any blog if the role also has blog.edit_any
+func (p *Policy) CanPublishBlog(actor Actor, blog *models.Blog) (Decision, error) {
+	allowed, err := p.perms.RoleHasPermission(actor.Role, models.PermBlogPublish)
+	if err != nil {
+		return Decision{}, err
+	}
+	if !allowed {
+		return Decision{Reason: "your role cannot publish blogs"}, nil
+	}
+	return p.ownerOr(actor, blog.UserID, models.PermBlogEditAny, "only the author can publish this blog")
+}
+
+// CanUpdateBlog allows the author or roles with blog.edit_any
+func (p *Policy) CanUpdateBlog(actor Actor, blog *models.Blog) (Decision, error) {
+	return p.ownerOr(actor, blog.UserID, models.PermBlogEditAny, "only the author can edit this blog")
+}
+
+// CanDeleteBlog allows the author or roles with blog.delete_any
+func (p *Policy) CanDeleteBlog(actor Actor, blog *models.Blog) (Decision, error) {
+	return p.ownerOr(actor, blog.UserID, models.PermBlogDeleteAny, "only the author can delete this blog")
+}
+
+// CanViewComment allows anyone who can see the blog to see its approved comments;
+// comments awaiting moderation, rejected or hidden are only visible to the commenter and
+// roles with comment.moderate
+func (p *Policy) CanViewComment(actor Actor, comment *models.Comment, blog *models.Blog) (Decision, error) {
+	if decision, err := p.CanViewBlog(actor, blog); err != nil || !decision.Allowed {
+		return decision, err
+	}
+	if comment.IsApproved() {
+		return Decision{Allowed: true}, nil
+	}
+	return p.ownerOr(actor, comment.OwnerID(), models.PermCommentModerate, "this comment is not published")
+}
+
+// CanSkipModeration allows the author of the blog and roles with comment.moderate to
+// publish comments on it without them being held for moderation
+func (p *Policy) CanSkipModeration(actor Actor, blog *models.Blog) (Decision, error) {
+	return p.ownerOr(actor, blog.UserID, models.PermCommentModerate, "comments on this blog are moderated")
+}
+
+// CanUpdateComment allows the commenter or roles with comment.moderate
+func (p *Policy) CanUpdateComment(actor Actor, comment *models.Comment) (Decision, error) {
+	return p.ownerOr(actor, comment.OwnerID(), models.PermCommentModerate, "only the author can edit this comment")
+}
+
+// CanDeleteComment allows the commenter or roles with comment.delete_any
+func (p *Policy) CanDeleteComment(actor Actor, comment *models.Comment) (Decision, error) {
+	return p.ownerOr(actor, comment.OwnerID(), models.PermCommentDeleteAny, "only the author can delete this comment")
+}
+
+// CanDeleteUser allows users to delete their own account and admins to delete any
+func (p *Policy) CanDeleteUser(actor Actor, userID uint) (Decision, error) {
+	if actor.UserID == userID || actor.Role == models.RoleAdmin {
+		return Decision{Allowed: true}, nil
+	}
+	return Decision{Reason: "you can only delete your own account"}, nil
+}
+
+// CanDeleteMedia allows users to delete their own uploads and admins to delete any
+func (p *Policy) CanDeleteMedia(actor Actor, media *models.Media) (Decision, error) {
+	if actor.UserID == media.UserID || actor.Role == models.RoleAdmin {
+		return Decision{Allowed: true}, nil
+	}
+	return Decision{Reason: "you can only delete your own uploads"}, nil
+}
+
+// ownerOr allows the owner of a resource, or an actor whose role grants permission
+func (p *Policy) ownerOr(actor Actor, ownerID uint, permission, reason string) (Decision, error) {
+	if actor.UserID == ownerID {
+		return Decision{Allowed: true}, nil
+	}
+
+	allowed, err := p.perms.RoleHasPermission(actor.Role, permission)
+	if err != nil {
+		return Decision{}, err
+	}
+	if !allowed {
+		return Decision{Reason: reason}, nil
+	}
+	return Decision{Allowed: true}, nil
+}
@@ -1,24 +1,32 @@
 package server
 
 import (
+	"errors"
 	"net/http"
+	"obs/internal/database"
 	"obs/internal/models"
 	"obs/internal/types"
 	"obs/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // AdminGetUsers retrieves all users (admin access only)
 func (s *Server) AdminGetUsers(c *gin.Context) {
-	users, err := s.db.AdminGetUsers()
+	q, ok := listQuery(c, database.UserListSpec)
+	if !ok {
+		return
+	}
+
+	users, meta, err := s.db.AdminGetUsers(q)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
 
-	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Users retrieved successfully", Data: map[string]any{"users": users}}
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Users retrieved successfully", Data: map[string]any{"users": users}, Meta: meta}
 	c.JSON(http.StatusOK, res)
 }
 
@@ -56,12 +64,19 @@ func (s *Server) AdminDeleteUser(c *gin.Context) {
 		return
 	}
 
+	keys, err := s.db.GetUserMediaKeys(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
 	err = s.db.AdminDeleteUser(id)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
+	s.deleteObjects(c.Request.Context(), keys...)
 
 	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "User deleted successfully"}
 	c.JSON(http.StatusOK, res)
@@ -76,12 +91,24 @@ func (s *Server) AdminUpdateUser(c *gin.Context) {
 		return
 	}
 
-	err := s.db.AdminUpdateUser(&user)
+	existing, err := s.db.GetUser(user.ID)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
+	if existing == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "User not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	if err := s.db.AdminUpdateUser(&user); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	s.reverifyEmail(user.ID, existing.Email)
 
 	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "User updated successfully", Data: map[string]any{"user": user}}
 	c.JSON(http.StatusOK, res)
@@ -89,14 +116,24 @@ func (s *Server) AdminUpdateUser(c *gin.Context) {
 
 // AdminGetBlogs retrieves all blogs (admin access only)
 func (s *Server) AdminGetBlogs(c *gin.Context) {
-	blogs, err := s.db.AdminGetBlogs()
+	q, ok := listQuery(c, database.BlogListSpec)
+	if !ok {
+		return
+	}
+
+	include, ok := blogIncludes(c)
+	if !ok {
+		return
+	}
+
+	blogs, meta, err := s.db.AdminGetBlogs(q, include)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
 
-	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blogs retrieved successfully", Data: map[string]any{"blogs": blogs}}
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blogs retrieved successfully", Data: map[string]any{"blogs": blogs}, Meta: meta}
 	c.JSON(http.StatusOK, res)
 }
 
@@ -134,12 +171,19 @@ func (s *Server) AdminDeleteBlog(c *gin.Context) {
 		return
 	}
 
+	keys, err := s.db.GetBlogMediaKeys(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
 	err = s.db.AdminDeleteBlog(id)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
+	s.deleteObjects(c.Request.Context(), keys...)
 
 	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blog deleted successfully"}
 	c.JSON(http.StatusOK, res)
@@ -154,7 +198,12 @@ func (s *Server) AdminUpdateBlog(c *gin.Context) {
 		return
 	}
 
-	err := s.db.AdminUpdateBlog(&blog)
+	err := s.db.AdminUpdateBlog(&blog, c.GetUint("user_id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
@@ -207,8 +256,13 @@ func (s *Server) AdminUpdateComment(c *gin.Context) {
 
 // AdminGetComments retrieves all comments (admin access only)
 func (s *Server) AdminGetComments(c *gin.Context) {
+	q, ok := listQuery(c, database.CommentListSpec)
+	if !ok {
+		return
+	}
+
 	// Call the database function to retrieve the comments
-	comments, err := s.db.AdminGetComments()
+	comments, meta, err := s.db.AdminGetComments(q)
 	if err != nil {
 		// Handle database error
 		res := types.Response{
@@ -227,6 +281,7 @@ func (s *Server) AdminGetComments(c *gin.Context) {
 		Success:    true,
 		Message:    "Comments retrieved successfully",
 		Data:       map[string]any{"comments": comments},
+		Meta:       meta,
 	}
 	c.JSON(http.StatusOK, res)
 }
@@ -256,3 +311,127 @@ func (s *Server) GetAdminDashboard(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, res)
 }
+
+// AdminRecountCounters recomputes the like, comment, view and follower counters and
+// reports how many rows had drifted (admin access only)
+func (s *Server) AdminRecountCounters(c *gin.Context) {
+	repairs, err := s.db.RecountCounters()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to recount counters", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Counters recounted successfully", Data: map[string]any{"repaired": repairs}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminGetUserSessions lists the active sessions of a user (admin access only)
+func (s *Server) AdminGetUserSessions(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid user ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	sessions, err := s.db.GetUserSessions(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	// Without the current flag, which only means something to the sessions' own user
+	sanitizedSessions := make([]utils.SanitizedSession, len(sessions))
+	for i, session := range sessions {
+		sanitizedSessions[i] = utils.SanitizedSessionData(&session)
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Sessions retrieved successfully", Data: map[string]any{"sessions": sanitizedSessions}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminRevokeUserSession revokes a single session of a user (admin access only)
+func (s *Server) AdminRevokeUserSession(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid user ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	sessionID, err := utils.ParseUintParam(c, "session_id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid session ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	err = s.db.RevokeUserSession(id, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Session not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Session revoked successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminRevokeUserSessions logs a user out of all devices (admin access only)
+func (s *Server) AdminRevokeUserSessions(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid user ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	revoked, err := s.db.RevokeAllSessions(id, 0)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Sessions revoked successfully", Data: map[string]any{"revoked": revoked}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminGetLockouts lists the accounts and IPs whose logins are currently throttled or locked (admin access only)
+func (s *Server) AdminGetLockouts(c *gin.Context) {
+	lockouts, err := s.loginGuard.List()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Lockouts retrieved successfully", Data: map[string]any{"lockouts": lockouts}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminClearLockout clears the failed logins of a key such as "account:jane@example.com" (admin access only)
+func (s *Server) AdminClearLockout(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Lockout key is required"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if err := s.loginGuard.Clear(key); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Lockout cleared successfully"}
+	c.JSON(http.StatusOK, res)
+}
@@ -1,15 +1,24 @@
 package server
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"obs/internal/database"
 	"obs/internal/models"
 	"obs/internal/types"
 	"obs/internal/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	accessTokenCookie  = "auth_token"
+	refreshTokenCookie = "refresh_token"
+	refreshTokenPath   = "/api/token"
+)
+
 func (s *Server) RegisterUser(c *gin.Context) {
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
@@ -32,6 +41,9 @@ func (s *Server) RegisterUser(c *gin.Context) {
 		return
 	}
 
+	// Roles are only ever granted by an admin
+	user.Role = models.RoleAuthor
+
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Internal server error", Error: err.Error()}
@@ -39,6 +51,8 @@ func (s *Server) RegisterUser(c *gin.Context) {
 		return
 	}
 	user.Password = string(hashedPassword)
+	now := time.Now()
+	user.PasswordSetAt = &now
 
 	if err := s.db.CreateUser(&user); err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error creating user", Error: err.Error()}
@@ -46,7 +60,11 @@ func (s *Server) RegisterUser(c *gin.Context) {
 		return
 	}
 
-	res := types.Response{StatusCode: http.StatusCreated, Success: true, Message: "User signed up successfully", Data: map[string]any{"user": utils.SanitizedUserData(&user)}}
+	if err := s.sendVerificationEmail(&user); err != nil {
+		log.Printf("[AUTH] Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	res := types.Response{StatusCode: http.StatusCreated, Success: true, Message: "User signed up successfully, check your email to verify your account", Data: map[string]any{"user": utils.SanitizedUserData(&user)}}
 	c.JSON(http.StatusCreated, res)
 }
 
@@ -59,47 +77,49 @@ func (s *Server) LoginUser(c *gin.Context) {
 		return
 	}
 
+	keys := loginKeys(c, creds.Identifier)
+	if !s.checkLoginAllowed(c, keys) {
+		return
+	}
+
 	user, err := s.db.GetUserByEmail(creds.Identifier)
 	if err != nil || user == nil {
-		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid credentials"}
-		c.JSON(http.StatusUnauthorized, res)
+		s.recordLoginFailure(c, keys, "Invalid credentials")
 		return
 	}
 
 	// Check password
 	if !utils.CheckPassword(creds.Password, user.Password) {
-		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid credentials"}
-		c.JSON(http.StatusUnauthorized, res)
+		s.recordLoginFailure(c, keys, "Invalid credentials")
 		return
 	}
 
-	// Check if the user is an admin or author
-	var role string
-	switch user.Role {
-	case "admin":
-		role = "admin"
-	default:
-		role = "author"
+	// Users with 2FA get a short-lived challenge token instead of a session;
+	// failures are only reset once the second factor is verified too
+	if user.IsTwoFactorEnabled() {
+		s.challengeTwoFactor(c, user)
+		return
 	}
 
-	token, err := utils.CreateJWT(user.ID, user.Username, user.Email, role) // pass role to JWT creation
-	if err != nil {
+	s.resetLoginFailures(creds.Identifier)
+	s.completeLogin(c, user)
+}
+
+// completeLogin starts a session for an authenticated user and responds with their profile
+func (s *Server) completeLogin(c *gin.Context, user *models.User) {
+	if user.IsBanned() {
+		res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Account has been suspended"}
+		c.JSON(http.StatusForbidden, res)
+		return
+	}
+
+	role := userRole(user)
+	if err := s.startSession(c, user, role); err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating token", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
 
-	// Set token as cookie
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "auth_token",
-		Value:    token,
-		HttpOnly: true,
-		Secure:   false,
-		Path:     "/",
-		MaxAge:   60 * 60 * 24 * 7,
-		SameSite: http.SameSiteLaxMode,
-	})
-
 	// Optionally sanitize user data before returning it
 	sanitizedUser := utils.SanitizedUserData(user)
 	res := types.Response{
@@ -111,11 +131,178 @@ func (s *Server) LoginUser(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
-// LogoutUser handles user logout by clearing the auth_token cookie
+// RefreshToken rotates the caller's refresh token and issues a fresh access token.
+// Presenting a refresh token that was already rotated revokes the whole session.
+func (s *Server) RefreshToken(c *gin.Context) {
+	refreshToken, err := c.Cookie(refreshTokenCookie)
+	if err != nil || refreshToken == "" {
+		var input struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil || input.RefreshToken == "" {
+			res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Refresh token required"}
+			c.JSON(http.StatusUnauthorized, res)
+			return
+		}
+		refreshToken = input.RefreshToken
+	}
+
+	stored, err := s.db.GetRefreshToken(utils.HashToken(refreshToken))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if stored == nil {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid refresh token"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	if stored.UsedAt != nil {
+		s.revokeReusedSession(c, stored.SessionID)
+		return
+	}
+	if !stored.Session.IsActive() || time.Now().After(stored.ExpiresAt) {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid or expired session"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	user, err := s.db.GetUser(stored.Session.UserID)
+	if err != nil || user == nil {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid or expired session"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	nextToken, err := utils.GenerateToken(32)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	next := models.RefreshToken{TokenHash: utils.HashToken(nextToken), ExpiresAt: time.Now().Add(utils.RefreshTokenTTL)}
+	if err := s.db.RotateRefreshToken(stored, &next); err != nil {
+		if errors.Is(err, database.ErrRefreshTokenReused) {
+			s.revokeReusedSession(c, stored.SessionID)
+			return
+		}
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if err := s.db.TouchSession(stored.SessionID, c.ClientIP()); err != nil {
+		log.Printf("[AUTH] Failed to update session %d activity: %v", stored.SessionID, err)
+	}
+
+	role := userRole(user)
+	accessToken, err := utils.CreateJWT(user.ID, stored.SessionID, user.Username, user.Email, role)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	setAuthCookies(c, accessToken, nextToken)
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Token refreshed successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// revokeReusedSession kills a session whose refresh token was replayed
+func (s *Server) revokeReusedSession(c *gin.Context, sessionID uint) {
+	log.Printf("[AUTH] Refresh token reuse detected, revoking session %d", sessionID)
+	if err := s.db.RevokeSession(sessionID); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	clearAuthCookies(c)
+	res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Refresh token reuse detected, session revoked"}
+	c.JSON(http.StatusUnauthorized, res)
+}
+
+// LogoutUser revokes the caller's session and clears the auth cookies
 func (s *Server) LogoutUser(c *gin.Context) {
-	// Clear the authentication cookie
+	if sessionID, exists := c.Get("session_id"); exists {
+		if err := s.db.RevokeSession(sessionID.(uint)); err != nil {
+			res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to revoke session", Error: err.Error()}
+			c.JSON(http.StatusInternalServerError, res)
+			return
+		}
+	}
+	clearAuthCookies(c)
+
+	res := types.Response{
+		StatusCode: http.StatusOK,
+		Success:    true,
+		Message:    "Logout successful",
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// userRole returns the user's role, treating unknown roles as author
+func userRole(user *models.User) string {
+	if models.IsValidRole(user.Role) {
+		return user.Role
+	}
+	return models.RoleAuthor
+}
+
+// startSession creates a server-side session for the user and sets the auth cookies
+func (s *Server) startSession(c *gin.Context, user *models.User, role string) error {
+	refreshToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+
+	session := models.Session{
+		UserID:     user.ID,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		LastSeenAt: time.Now(),
+		ExpiresAt:  time.Now().Add(utils.RefreshTokenTTL),
+	}
+	token := models.RefreshToken{TokenHash: utils.HashToken(refreshToken), ExpiresAt: session.ExpiresAt}
+	if err := s.db.CreateSession(&session, &token); err != nil {
+		return err
+	}
+
+	accessToken, err := utils.CreateJWT(user.ID, session.ID, user.Username, user.Email, role) // pass role to JWT creation
+	if err != nil {
+		return err
+	}
+	setAuthCookies(c, accessToken, refreshToken)
+	return nil
+}
+
+// setAuthCookies stores the access token and refresh token as HTTP-only cookies.
+// The refresh token is scoped to the refresh endpoint so it is not sent with every request.
+func setAuthCookies(c *gin.Context, accessToken, refreshToken string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    accessToken,
+		HttpOnly: true,
+		Secure:   false,
+		Path:     "/",
+		MaxAge:   int(utils.AccessTokenTTL.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    refreshToken,
+		HttpOnly: true,
+		Secure:   false,
+		Path:     refreshTokenPath,
+		MaxAge:   int(utils.RefreshTokenTTL.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearAuthCookies expires both auth cookies immediately
+func clearAuthCookies(c *gin.Context) {
 	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "auth_token",
+		Name:     accessTokenCookie,
 		Value:    "",
 		HttpOnly: true,
 		Secure:   false,
@@ -123,11 +310,13 @@ func (s *Server) LogoutUser(c *gin.Context) {
 		MaxAge:   -1, // Expire the cookie immediately
 		SameSite: http.SameSiteLaxMode,
 	})
-
-	res := types.Response{
-		StatusCode: http.StatusOK,
-		Success:    true,
-		Message:    "Logout successful",
-	}
-	c.JSON(http.StatusOK, res)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    "",
+		HttpOnly: true,
+		Secure:   false,
+		Path:     refreshTokenPath,
+		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
+	})
 }
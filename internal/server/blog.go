@@ -4,24 +4,38 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"obs/internal/database"
 	"obs/internal/models"
+	"obs/internal/policy"
 	"obs/internal/types"
 	"obs/internal/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// GetAllBlogs handles retrieving all blogs
+// GetAllBlogs handles retrieving all published blogs and the caller's own unpublished ones
 func (s *Server) GetAllBlogs(c *gin.Context) {
-	blogs, err := s.db.GetBlogs()
+	q, ok := listQuery(c, database.BlogListSpec)
+	if !ok {
+		return
+	}
+
+	include, ok := blogIncludes(c)
+	if !ok {
+		return
+	}
+
+	blogs, meta, err := s.db.GetBlogs(c.GetUint("user_id"), q, include)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch blogs", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
 
-	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blogs fetched successfully", Data: map[string]any{"blogs": blogs}}
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blogs fetched successfully", Data: map[string]any{"blogs": blogs}, Meta: meta}
 	c.JSON(http.StatusOK, res)
 }
 
@@ -46,20 +60,117 @@ func (s *Server) GetBlogByID(c *gin.Context) {
 		return
 	}
 
+	if !s.checkBlogVisible(c, blog) {
+		return
+	}
+
 	user := utils.SanitizedUserData(&blog.User)
-	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blog fetched successfully", Data: map[string]any{"blog": blog, "user": user}}
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blog fetched successfully", Data: map[string]any{"blog": blog, "user": user, "permalink": blogPermalink(blog)}}
 	c.JSON(http.StatusOK, res)
 }
 
+// GetBlogBySlug handles retrieving a blog by its author's handle and slug. Old slugs
+// and outdated handles are redirected to the current permalink.
+func (s *Server) GetBlogBySlug(c *gin.Context) {
+	handle, slug := c.Param("handle"), c.Param("slug")
+
+	blog, err := s.db.GetBlogBySlug(slug)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching blog", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	renamed := false
+	if blog == nil {
+		if blog, err = s.db.GetBlogByOldSlug(slug); err != nil {
+			res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching blog", Error: err.Error()}
+			c.JSON(http.StatusInternalServerError, res)
+			return
+		}
+		renamed = true
+	}
+	if blog == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if !s.checkBlogVisible(c, blog) {
+		return
+	}
+
+	if renamed || handle != blog.User.Username {
+		c.Redirect(http.StatusMovedPermanently, blogPermalink(blog))
+		return
+	}
+
+	user := utils.SanitizedUserData(&blog.User)
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blog fetched successfully", Data: map[string]any{"blog": blog, "user": user, "permalink": blogPermalink(blog)}}
+	c.JSON(http.StatusOK, res)
+}
+
+// findVisibleBlog loads a blog, responding with 404 or 500 unless the caller may see it
+func (s *Server) findVisibleBlog(c *gin.Context, id uint) (*models.Blog, bool) {
+	blog, err := s.db.GetBlog(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching blog", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	if blog == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return nil, false
+	}
+	if !s.checkBlogVisible(c, blog) {
+		return nil, false
+	}
+	return blog, true
+}
+
+// checkBlogVisible responds with 404 unless the caller may see the blog, so unpublished
+// blogs are reported as missing to everyone else
+func (s *Server) checkBlogVisible(c *gin.Context, blog *models.Blog) bool {
+	actor, _ := policy.ActorFromContext(c)
+	decision, err := s.policy.CanViewBlog(actor, blog)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return false
+	}
+	if !decision.Allowed {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return false
+	}
+	return true
+}
+
+// blogPermalink returns the canonical author handle and slug URL of a blog, percent-encoding
+// slugs in scripts that are not transliterated
+func blogPermalink(blog *models.Blog) string {
+	return "/api/blog/u/" + url.PathEscape(blog.User.Username) + "/" + url.PathEscape(blog.Slug)
+}
+
 // CreateNewBlog handles creating a new blog
 func (s *Server) CreateNewBlog(c *gin.Context) {
-	var blog models.Blog
-	if err := c.ShouldBindJSON(&blog); err != nil {
+	var input types.BlogInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid blog data", Error: err.Error()}
 		c.JSON(http.StatusBadRequest, res)
 		return
 	}
 
+	categoryID, ok := s.checkCategory(c, input.CategoryID)
+	if !ok {
+		return
+	}
+
+	blog := models.Blog{Title: input.Title, Content: input.Content, Status: input.Status, CategoryID: categoryID}
+	for _, name := range input.Tags {
+		blog.Tags = append(blog.Tags, models.Tag{Name: name})
+	}
+
 	// Set UserID from authenticated user (assuming middleware sets it)
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -77,6 +188,24 @@ func (s *Server) CreateNewBlog(c *gin.Context) {
 	blog.UserID = userID.(uint)
 	blog.Author = author.(string)
 
+	// New blogs start as drafts unless the author may publish straight away
+	switch blog.Status {
+	case "", models.BlogStatusDraft:
+		blog.Status = models.BlogStatusDraft
+	case models.BlogStatusPublished:
+		actor, _ := policy.ActorFromContext(c)
+		decision, err := s.policy.CanPublishBlog(actor, &blog)
+		if !authorize(c, decision, err) {
+			return
+		}
+		now := time.Now()
+		blog.PublishedAt = &now
+	default:
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "New blogs can only be created as draft or published, use the schedule endpoint to schedule them"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
 	fmt.Printf("blog data: %+v\n", blog)
 	fmt.Printf("Creating blog with Author: %s\n", blog.Author)
 	createdBlog, err := s.db.CreateBlog(&blog)
@@ -90,7 +219,7 @@ func (s *Server) CreateNewBlog(c *gin.Context) {
 	c.JSON(http.StatusCreated, res)
 }
 
-// DeleteBlogByID handles deleting a blog by ID
+// DeleteBlogByID handles deleting a blog by ID if the user may delete it
 func (s *Server) DeleteBlogByID(c *gin.Context) {
 	id, err := utils.ParseUintParam(c, "blog_id")
 	if err != nil {
@@ -99,6 +228,33 @@ func (s *Server) DeleteBlogByID(c *gin.Context) {
 		return
 	}
 
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+
+	blog, err := s.db.GetBlog(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching blog", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if blog == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	decision, err := s.policy.CanDeleteBlog(actor, blog)
+	if !authorize(c, decision, err) {
+		return
+	}
+
+	keys, err := s.db.GetBlogMediaKeys(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to delete blog", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
 	err = s.db.DeleteBlog(id)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
@@ -110,12 +266,14 @@ func (s *Server) DeleteBlogByID(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
+	// The cover records went with the blog; remove their files too
+	s.deleteObjects(c.Request.Context(), keys...)
 
 	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blog deleted successfully"}
 	c.JSON(http.StatusOK, res)
 }
 
-// UpdateBlog handles updating a blog
+// UpdateBlog handles updating a blog if the user may edit it
 func (s *Server) UpdateBlog(c *gin.Context) {
 	id, err := utils.ParseUintParam(c, "blog_id")
 	if err != nil {
@@ -124,13 +282,18 @@ func (s *Server) UpdateBlog(c *gin.Context) {
 		return
 	}
 
-	var input models.Blog
+	var input types.BlogInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid blog data", Error: err.Error()}
 		c.JSON(http.StatusBadRequest, res)
 		return
 	}
 
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+
 	// Fetch the existing blog
 	existingBlog, err := s.db.GetBlog(id)
 	if err != nil {
@@ -143,12 +306,25 @@ func (s *Server) UpdateBlog(c *gin.Context) {
 		c.JSON(http.StatusNotFound, res)
 		return
 	}
+	decision, err := s.policy.CanUpdateBlog(actor, existingBlog)
+	if !authorize(c, decision, err) {
+		return
+	}
+
+	var categoryID *uint
+	if input.CategoryID != nil {
+		if categoryID, ok = s.checkCategory(c, input.CategoryID); !ok {
+			return
+		}
+	}
 
 	// Only update allowed fields
 	existingBlog.Title = input.Title
 	existingBlog.Content = input.Content
 
-	err = s.db.UpdateBlog(existingBlog)
+	// Tags and category are only changed when they are part of the request
+	update := database.BlogUpdate{Tags: input.Tags, SetCategory: input.CategoryID != nil, CategoryID: categoryID}
+	err = s.db.UpdateBlog(existingBlog, actor.UserID, update)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to update blog", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
@@ -177,6 +353,11 @@ func (s *Server) UpdateViewHandler(c *gin.Context) {
 		return
 	}
 
+	// Views only count on blogs the user can see
+	if _, ok := s.findVisibleBlog(c, blogID); !ok {
+		return
+	}
+
 	// Call the database function to track the view
 	err = s.db.UpdateView(blogID, userID.(uint))
 	if err != nil {
@@ -4,14 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"obs/internal/database"
 	"obs/internal/models"
+	"obs/internal/policy"
 	"obs/internal/types"
 	"obs/internal/utils"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// maxThreadReplies caps ?replies=, the replies nested per comment of a thread
+const maxThreadReplies = 50
+
 // GetAllComments retrieves comments for a blog
 func (s *Server) GetAllComments(c *gin.Context) {
 	blogID, err := utils.ParseUintParam(c, "blog_id")
@@ -20,13 +26,142 @@ func (s *Server) GetAllComments(c *gin.Context) {
 		return
 	}
 
-	comments, err := s.db.GetComments(blogID)
+	if _, ok := s.findVisibleBlog(c, blogID); !ok {
+		return
+	}
+
+	q, ok := listQuery(c, database.CommentListSpec)
+	if !ok {
+		return
+	}
+
+	comments, meta, err := s.db.GetComments(blogID, c.GetUint("user_id"), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Data: gin.H{"comments": comments}, Meta: meta})
+}
+
+// GetCommentTree retrieves a page of the top-level comments of a blog with their replies
+// nested under them, ?depth= levels deep and ?replies= per comment
+func (s *Server) GetCommentTree(c *gin.Context) {
+	blogID, err := utils.ParseUintParam(c, "blog_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid blog ID"})
+		return
+	}
+
+	if _, ok := s.findVisibleBlog(c, blogID); !ok {
+		return
+	}
+
+	q, ok := listQuery(c, database.CommentListSpec)
+	if !ok {
+		return
+	}
+	depth, replies, ok := s.threadParams(c)
+	if !ok {
+		return
+	}
+
+	comments, meta, err := s.db.GetCommentTree(blogID, c.GetUint("user_id"), q, depth, replies)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Data: gin.H{"comments": comments}, Meta: meta})
+}
+
+// GetCommentThread retrieves a comment with its replies nested under it, ?depth= levels
+// deep and ?replies= per comment
+func (s *Server) GetCommentThread(c *gin.Context) {
+	commentID, err := utils.ParseUintParam(c, "comment_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid comment ID"})
+		return
+	}
+
+	depth, replies, ok := s.threadParams(c)
+	if !ok {
+		return
+	}
+
+	thread, err := s.db.GetCommentThread(commentID, c.GetUint("user_id"), depth, replies)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching comment"})
+		return
+	}
+	if thread == nil {
+		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found"})
+		return
+	}
+	if !s.checkCommentVisible(c, &thread.Comment) {
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Data: gin.H{"comment": thread}})
+}
+
+// GetCommentReplies retrieves a page of the replies to a comment, oldest first, continuing
+// from the next_cursor of a thread. Each reply has its own replies nested under it like in
+// a thread.
+func (s *Server) GetCommentReplies(c *gin.Context) {
+	commentID, err := utils.ParseUintParam(c, "comment_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid comment ID"})
+		return
+	}
+
+	q, ok := listQuery(c, database.ReplyListSpec)
+	if !ok {
+		return
+	}
+	depth, replies, ok := s.threadParams(c)
+	if !ok {
+		return
+	}
+
+	parent, err := s.db.GetComment(commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching comment"})
+		return
+	}
+	if parent == nil {
+		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found"})
+		return
+	}
+	if !s.checkCommentVisible(c, parent) {
+		return
+	}
+
+	// Depth counts levels below the comment, the page of replies being the first of them
+	comments, meta, err := s.db.GetCommentReplies(commentID, c.GetUint("user_id"), q, depth-1, replies)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching comments"})
 		return
 	}
 
-	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Data: gin.H{"comments": comments}})
+	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Data: gin.H{"replies": comments}, Meta: meta})
+}
+
+// threadParams parses ?depth=, the levels of replies to nest (default 2, at most the
+// configured max depth), and ?replies=, how many replies to nest per comment (default 5,
+// at most 50), responding with 400 when they are invalid
+func (s *Server) threadParams(c *gin.Context) (int, int, bool) {
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", "2"))
+	if err != nil || depth < 0 {
+		c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid list parameters", Error: "depth must be a non-negative integer"})
+		return 0, 0, false
+	}
+	replies, err := strconv.Atoi(c.DefaultQuery("replies", "5"))
+	if err != nil || replies < 1 {
+		c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid list parameters", Error: "replies must be a positive integer"})
+		return 0, 0, false
+	}
+	return min(depth, s.commentMaxDepth), min(replies, maxThreadReplies), true
 }
 
 // GetCommentByID retrieves a single comment
@@ -46,6 +181,9 @@ func (s *Server) GetCommentByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found"})
 		return
 	}
+	if !s.checkCommentVisible(c, comment) {
+		return
+	}
 
 	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Data: gin.H{"comment": comment}})
 }
@@ -53,8 +191,9 @@ func (s *Server) GetCommentByID(c *gin.Context) {
 // CreateNewComment inserts a new comment
 func (s *Server) CreateNewComment(c *gin.Context) {
 	var input struct {
-		BlogID  uint   `json:"blog_id" binding:"required"`
-		Content string `json:"content" binding:"required,min=3"`
+		BlogID   uint   `json:"blog_id" binding:"required"`
+		ParentID *uint  `json:"parent_id"` // Comment being replied to
+		Content  string `json:"content" binding:"required,min=3"`
 	}
 	fmt.Printf("%+v\n", input)
 
@@ -74,22 +213,78 @@ func (s *Server) CreateNewComment(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized"})
 		return
 	}
+
+	// Comments can only be left on blogs the user can see
+	blog, err := s.db.GetBlog(input.BlogID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching blog"})
+		return
+	}
+	actor, _ := policy.ActorFromContext(c)
+	if blog != nil {
+		decision, err := s.policy.CanViewBlog(actor, blog)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error"})
+			return
+		}
+		if !decision.Allowed {
+			blog = nil
+		}
+	}
+	if blog == nil {
+		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"})
+		return
+	}
+	uid := userID.(uint)
 	comment := models.Comment{
 		BlogID:  input.BlogID,
-		UserID:  userID.(uint),
+		UserID:  &uid,
 		Author:  username.(string),
 		Content: input.Content,
 	}
 
-	if err := s.db.CreateComment(&comment); err != nil {
+	// Replies go on a live, approved comment of the same blog, no deeper than the configured depth
+	if input.ParentID != nil {
+		parent, err := s.db.GetComment(*input.ParentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching comment"})
+			return
+		}
+		if parent == nil || parent.BlogID != input.BlogID || parent.IsDeleted() || !parent.IsApproved() {
+			c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid parent comment"})
+			return
+		}
+		if parent.Depth+1 > s.commentMaxDepth {
+			c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: fmt.Sprintf("Replies cannot be nested more than %d levels deep", s.commentMaxDepth)})
+			return
+		}
+		comment.ParentID = &parent.ID
+		comment.Depth = parent.Depth + 1
+	}
+
+	status, reason, err := s.newCommentStatus(c.Request.Context(), actor, blog, &comment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error"})
+		return
+	}
+	comment.Status = status
+
+	if err := s.db.CreateComment(&comment, reason); err != nil {
 		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to create comment"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, types.Response{StatusCode: http.StatusCreated, Success: true, Data: gin.H{"comment": comment}})
+	message := "Comment created successfully"
+	switch comment.Status {
+	case models.CommentStatusPending:
+		message = "Comment is awaiting moderation"
+	case models.CommentStatusRejected:
+		message = "Comment was rejected as spam"
+	}
+	c.JSON(http.StatusCreated, types.Response{StatusCode: http.StatusCreated, Success: true, Message: message, Data: gin.H{"comment": comment}})
 }
 
-// UpdateComment modifies a comment if the user is the owner
+// UpdateComment modifies a comment if the user may edit it
 func (s *Server) UpdateComment(c *gin.Context) {
 	commentID, err := utils.ParseUintParam(c, "comment_id")
 	if err != nil {
@@ -105,15 +300,30 @@ func (s *Server) UpdateComment(c *gin.Context) {
 		return
 	}
 
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized"})
+	actor, ok := requireActor(c)
+	if !ok {
 		return
 	}
 
-	err = s.db.UpdateComment(commentID, userID.(uint), input.Content)
+	comment, ok := s.findComment(c, commentID)
+	if !ok {
+		return
+	}
+	decision, err := s.policy.CanUpdateComment(actor, comment)
+	if !authorize(c, decision, err) {
+		return
+	}
+
+	// The new content goes through the spam check and moderation like a new comment
+	status, reason, err := s.editedCommentStatus(c.Request.Context(), actor, comment, input.Content)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error"})
+		return
+	}
+
+	err = s.db.UpdateComment(commentID, input.Content, status, reason)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found or not owned by user"})
+		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found"})
 		return
 	}
 	if err != nil {
@@ -121,23 +331,48 @@ func (s *Server) UpdateComment(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Message: "Comment updated successfully"})
+	message := "Comment updated successfully"
+	switch status {
+	case models.CommentStatusPending:
+		message = "Comment is awaiting moderation"
+	case models.CommentStatusRejected:
+		message = "Comment was rejected as spam"
+	}
+	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Message: message})
 }
 
-// DeleteCommentByID deletes a comment if the user is the owner
+// DeleteCommentByID deletes a comment if the user may delete it. The comment is taken
+// from the :comment_id param, or from the request body on the legacy DELETE /comment route.
 func (s *Server) DeleteCommentByID(c *gin.Context) {
-	var input struct {
-		CommentId uint `json:"comment_id" binding:"required"`
-		UserId    uint `json:"user_id" binding:"required"`
+	commentID, err := utils.ParseUintParam(c, "comment_id")
+	if err != nil {
+		var input struct {
+			CommentId uint `json:"comment_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input data"})
+			return
+		}
+		commentID = input.CommentId
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input data"})
+	actor, ok := requireActor(c)
+	if !ok {
 		return
 	}
-	err := s.db.DeleteComment(input.CommentId, input.UserId)
+
+	comment, ok := s.findComment(c, commentID)
+	if !ok {
+		return
+	}
+	decision, err := s.policy.CanDeleteComment(actor, comment)
+	if !authorize(c, decision, err) {
+		return
+	}
+
+	err = s.db.DeleteComment(commentID)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found or not owned by user"})
+		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found"})
 		return
 	}
 	if err != nil {
@@ -147,3 +382,44 @@ func (s *Server) DeleteCommentByID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, types.Response{StatusCode: http.StatusOK, Success: true, Message: "Comment deleted successfully"})
 }
+
+// checkCommentVisible responds with 404 unless the caller may see the comment and its
+// blog, so comments that are not published are reported as missing to everyone else
+func (s *Server) checkCommentVisible(c *gin.Context, comment *models.Comment) bool {
+	blog, err := s.db.GetBlog(comment.BlogID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching blog"})
+		return false
+	}
+	if blog == nil {
+		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found"})
+		return false
+	}
+
+	actor, _ := policy.ActorFromContext(c)
+	decision, err := s.policy.CanViewComment(actor, comment, blog)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error"})
+		return false
+	}
+	if !decision.Allowed {
+		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found"})
+		return false
+	}
+	return true
+}
+
+// findComment loads a comment, responding with 404 or 500 when it cannot be used.
+// Tombstones cannot be edited or deleted, so they are not found.
+func (s *Server) findComment(c *gin.Context, id uint) (*models.Comment, bool) {
+	comment, err := s.db.GetComment(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching comment"})
+		return nil, false
+	}
+	if comment == nil || comment.IsDeleted() {
+		c.JSON(http.StatusNotFound, types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Comment not found"})
+		return nil, false
+	}
+	return comment, true
+}
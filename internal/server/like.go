@@ -56,6 +56,9 @@ func (s *Server) LikeBlog(c *gin.Context) {
 		})
 		return
 	}
+	if !s.checkBlogVisible(c, blog) {
+		return
+	}
 
 	// Create like entry
 	likeEntry := models.Like{
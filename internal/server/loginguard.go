@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"obs/internal/loginguard"
+	"obs/internal/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginGuardPruneInterval is how often stale login attempts are deleted
+const loginGuardPruneInterval = time.Hour
+
+// runLoginGuardPruner deletes login attempts whose failures no longer count, so the
+// tracker does not keep a record of every account and IP that ever failed a login
+func (s *Server) runLoginGuardPruner(ctx context.Context) {
+	ticker := time.NewTicker(loginGuardPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := s.loginGuard.Prune()
+		if err != nil {
+			log.Printf("[LOGIN GUARD] Failed to prune login attempts: %v", err)
+			continue
+		}
+		if pruned > 0 {
+			log.Printf("[LOGIN GUARD] Pruned %d stale login attempt(s)", pruned)
+		}
+	}
+}
+
+// loginKeys returns the tracker keys for a login attempt: the account and the client IP
+func loginKeys(c *gin.Context, identifier string) []string {
+	return []string{loginguard.AccountKey(identifier), loginguard.IPKey(c.ClientIP())}
+}
+
+// checkLoginAllowed responds with 429 and returns false when any of the keys is throttled.
+// Tracker failures are logged and do not block the login.
+func (s *Server) checkLoginAllowed(c *gin.Context, keys []string) bool {
+	for _, key := range keys {
+		status, err := s.loginGuard.Check(key)
+		if err != nil {
+			log.Printf("[AUTH] Failed to check login attempts for %s: %v", key, err)
+			continue
+		}
+		if status.Blocked {
+			respondLoginBlocked(c, status)
+			return false
+		}
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed login against every key and responds with 401,
+// or with 429 and a lockout notice once the failure locked an account or IP
+func (s *Server) recordLoginFailure(c *gin.Context, keys []string, message string) {
+	var blocked *loginguard.Status
+	for _, key := range keys {
+		status, err := s.loginGuard.RecordFailure(key)
+		if err != nil {
+			log.Printf("[AUTH] Failed to record login failure for %s: %v", key, err)
+			continue
+		}
+		if status.Locked {
+			log.Printf("[AUTH] %s locked until %s after %d failed logins", key, status.LockedUntil.Format(time.RFC3339), status.Failures)
+		}
+		if status.Locked && (blocked == nil || !blocked.Locked || status.RetryAfter > blocked.RetryAfter) {
+			blocked = &status
+		}
+	}
+
+	if blocked != nil {
+		respondLoginBlocked(c, *blocked)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: message}
+	c.JSON(http.StatusUnauthorized, res)
+}
+
+// resetLoginFailures clears the account failures after a successful login. The IP
+// counter is left alone so one valid account cannot reset it for a guessing client.
+func (s *Server) resetLoginFailures(identifier string) {
+	if err := s.loginGuard.Reset(loginguard.AccountKey(identifier)); err != nil {
+		log.Printf("[AUTH] Failed to reset login attempts: %v", err)
+	}
+}
+
+// respondLoginBlocked writes the 429 response for a throttled or locked login
+func respondLoginBlocked(c *gin.Context, status loginguard.Status) {
+	retryAfter := int(math.Ceil(status.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	message := "Too many failed login attempts, please try again later"
+	data := map[string]any{"retry_after": retryAfter, "locked": status.Locked}
+	if status.Locked {
+		message = "Too many failed login attempts, login is temporarily locked"
+		data["locked_until"] = status.LockedUntil
+	}
+
+	res := types.Response{StatusCode: http.StatusTooManyRequests, Success: false, Message: message, Data: data}
+	c.JSON(http.StatusTooManyRequests, res)
+}
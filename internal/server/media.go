@@ -0,0 +1,416 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"obs/internal/database"
+	"obs/internal/imaging"
+	"obs/internal/models"
+	"obs/internal/storage"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxAvatarSize caps profile picture uploads
+const maxAvatarSize = 2 << 20
+
+// mediaURLTTL is how long the storage URLs media redirects to stay valid
+const mediaURLTTL = 15 * time.Minute
+
+// mediaTypes maps the image types uploads may have, judged by their content, to the
+// extension they are stored with
+var mediaTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// UploadAvatar stores an uploaded image as the user's next profile picture. It takes its
+// place once its renditions are made, see processMedia.
+func (s *Server) UploadAvatar(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+	// Only one avatar is kept per user, so avatars do not count against the quota
+	media, ok := s.receiveUpload(c, models.Media{UserID: actor.UserID, Kind: models.MediaKindAvatar}, maxAvatarSize, math.MaxInt64)
+	if !ok {
+		return
+	}
+	s.wakeMediaProcessor()
+
+	res := types.Response{StatusCode: http.StatusAccepted, Success: true, Message: "Profile picture uploaded, it is being processed", Data: map[string]any{"media": media}}
+	c.JSON(http.StatusAccepted, res)
+}
+
+// UploadBlogCover stores an uploaded image as the blog's next cover. It takes its place
+// once its renditions are made, see processMedia.
+func (s *Server) UploadBlogCover(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+	blog, ok := s.editableBlog(c)
+	if !ok {
+		return
+	}
+	// The upload counts against the quota of whoever uploaded it, author or editor
+	media, ok := s.receiveUpload(c, models.Media{UserID: actor.UserID, BlogID: &blog.ID, Kind: models.MediaKindCover}, s.maxUploadSize, s.mediaQuota)
+	if !ok {
+		return
+	}
+	s.wakeMediaProcessor()
+
+	res := types.Response{StatusCode: http.StatusAccepted, Success: true, Message: "Cover uploaded, it is being processed", Data: map[string]any{"media": media}}
+	c.JSON(http.StatusAccepted, res)
+}
+
+// DeleteBlogCover removes the blog's cover image
+func (s *Server) DeleteBlogCover(c *gin.Context) {
+	blog, ok := s.editableBlog(c)
+	if !ok {
+		return
+	}
+
+	covers, err := s.db.ClearBlogCover(blog.ID)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to remove cover", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	for _, cover := range covers {
+		s.deleteObjects(c.Request.Context(), cover.StorageKeys()...)
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Cover removed successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// UploadImage stores an image to embed in blog posts, stripped of its metadata
+func (s *Server) UploadImage(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+	media, ok := s.receiveUpload(c, models.Media{UserID: actor.UserID, Kind: models.MediaKindImage}, s.maxUploadSize, s.mediaQuota)
+	if !ok {
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusCreated, Success: true, Message: "Image uploaded successfully", Data: map[string]any{"media": media, "url": s.mediaURL(media.ID)}}
+	c.JSON(http.StatusCreated, res)
+}
+
+// GetMyMedia lists the user's uploads along with their storage usage
+func (s *Server) GetMyMedia(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+	q, ok := listQuery(c, database.MediaListSpec)
+	if !ok {
+		return
+	}
+
+	media, meta, err := s.db.GetUserMedia(actor.UserID, q)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch media", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	usage, err := s.db.GetMediaUsage(actor.UserID)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch storage usage", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	urls := make(map[uint]models.Renditions, len(media))
+	for _, m := range media {
+		urls[m.ID] = s.renditionURLs(&m)
+	}
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Media fetched successfully", Data: map[string]any{
+		"media": media,
+		"urls":  urls,
+		"usage": usage,
+		"quota": s.mediaQuota,
+	}, Meta: meta}
+	c.JSON(http.StatusOK, res)
+}
+
+// DeleteMedia deletes an upload and its file
+func (s *Server) DeleteMedia(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+	media, ok := s.findMedia(c)
+	if !ok {
+		return
+	}
+	decision, err := s.policy.CanDeleteMedia(actor, media)
+	if !authorize(c, decision, err) {
+		return
+	}
+
+	if err := s.db.DeleteMedia(media.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Media not found"}
+			c.JSON(http.StatusNotFound, res)
+			return
+		}
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to delete media", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	s.deleteObjects(c.Request.Context(), media.StorageKeys()...)
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Media deleted successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// ServeMedia redirects to a short-lived signed URL of the upload's file, or of the
+// rendition named by :rendition, the largest one by default. Media URLs are stable, so
+// they can be stored in profiles and blog content.
+func (s *Server) ServeMedia(c *gin.Context) {
+	media, ok := s.findMedia(c)
+	if !ok {
+		return
+	}
+	if media.Status != models.MediaStatusReady {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Media is not available", Error: media.Error}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	key := media.Key
+	if len(media.Renditions) > 0 {
+		name := c.Param("rendition")
+		if name == "" {
+			name = strconv.Itoa(imaging.Sizes[len(imaging.Sizes)-1])
+		}
+		if key, ok = media.Renditions[name]; !ok {
+			res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Rendition not found"}
+			c.JSON(http.StatusNotFound, res)
+			return
+		}
+	} else if c.Param("rendition") != "" {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Rendition not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	url, err := s.storage.SignedURL(c.Request.Context(), key, mediaURLTTL)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to sign media URL", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	// Let clients reuse the redirect for a while, but not past the signature's expiry
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(mediaURLTTL.Seconds())/3))
+	c.Redirect(http.StatusFound, url)
+}
+
+// ServeMediaFile serves a file from local storage to holders of a signed URL
+func (s *Server) ServeMediaFile(c *gin.Context) {
+	local, ok := s.storage.(*storage.LocalStorage)
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !ok || !storage.ValidKey(key) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "File not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if !local.Verify(key, c.Query("expires"), c.Query("signature")) {
+		res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Invalid or expired signature"}
+		c.JSON(http.StatusForbidden, res)
+		return
+	}
+
+	body, object, err := local.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "File not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to read file", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, object.Size, object.ContentType, body, map[string]string{
+		"Cache-Control":          "private, max-age=300",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// receiveUpload stores the multipart "file" field of the request and records it as media,
+// filled in from the template. The type is sniffed from the content rather than trusted
+// from the client.
+func (s *Server) receiveUpload(c *gin.Context, media models.Media, maxSize, quota int64) (*models.Media, bool) {
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			res := types.Response{StatusCode: http.StatusRequestEntityTooLarge, Success: false, Message: fmt.Sprintf("File is larger than %d MB", maxSize>>20)}
+			c.JSON(http.StatusRequestEntityTooLarge, res)
+			return nil, false
+		}
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "A file upload is required", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return nil, false
+	}
+	if header.Size > maxSize {
+		res := types.Response{StatusCode: http.StatusRequestEntityTooLarge, Success: false, Message: fmt.Sprintf("File is larger than %d MB", maxSize>>20)}
+		c.JSON(http.StatusRequestEntityTooLarge, res)
+		return nil, false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Failed to read upload", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return nil, false
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Failed to read upload", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return nil, false
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	ext, ok := mediaTypes[contentType]
+	if !ok {
+		res := types.Response{StatusCode: http.StatusUnsupportedMediaType, Success: false, Message: "Only JPEG, PNG, GIF and WebP images can be uploaded"}
+		c.JSON(http.StatusUnsupportedMediaType, res)
+		return nil, false
+	}
+
+	body := io.Reader(io.MultiReader(bytes.NewReader(head), file))
+	size := header.Size
+	// Embedded images are served as uploaded, so they are re-encoded now to drop their
+	// EXIF and GPS metadata. Avatars and covers lose theirs when their renditions are made.
+	if media.Kind == models.MediaKindImage {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Failed to read upload", Error: err.Error()}
+			c.JSON(http.StatusBadRequest, res)
+			return nil, false
+		}
+		if data, contentType, err = imaging.Strip(data); err != nil {
+			if errors.Is(err, imaging.ErrTooLarge) {
+				res := types.Response{StatusCode: http.StatusRequestEntityTooLarge, Success: false, Message: fmt.Sprintf("Images can be at most %d pixels wide and high", imaging.MaxDimension), Error: err.Error()}
+				c.JSON(http.StatusRequestEntityTooLarge, res)
+				return nil, false
+			}
+			res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Image could not be processed", Error: err.Error()}
+			c.JSON(http.StatusBadRequest, res)
+			return nil, false
+		}
+		ext = mediaTypes[contentType]
+		body, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	token, err := utils.GenerateToken(16)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to name upload", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	media.Key = fmt.Sprintf("%ss/%d/%s.%s", media.Kind, media.UserID, token, ext)
+	media.ContentType = contentType
+	media.Size = size
+	media.Status = models.MediaStatusReady
+	if media.Kind == models.MediaKindAvatar || media.Kind == models.MediaKindCover {
+		media.Status = models.MediaStatusPending
+	}
+
+	if err := s.storage.Put(c.Request.Context(), media.Key, body, media.Size, contentType); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to store upload", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	if err := s.db.CreateMedia(&media, quota); err != nil {
+		s.deleteObjects(c.Request.Context(), media.Key)
+		if errors.Is(err, database.ErrQuotaExceeded) {
+			res := types.Response{StatusCode: http.StatusRequestEntityTooLarge, Success: false, Message: fmt.Sprintf("Upload would exceed your %d MB storage quota", quota>>20)}
+			c.JSON(http.StatusRequestEntityTooLarge, res)
+			return nil, false
+		}
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to save upload", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	return &media, true
+}
+
+// findMedia loads the media named by the :id parameter, responding when it is missing
+func (s *Server) findMedia(c *gin.Context) (*models.Media, bool) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid media ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return nil, false
+	}
+	media, err := s.db.GetMedia(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching media", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	if media == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Media not found"}
+		c.JSON(http.StatusNotFound, res)
+		return nil, false
+	}
+	return media, true
+}
+
+// deleteObjects removes files from storage. Failures only leave orphaned files behind, so
+// they are logged rather than failing the request.
+func (s *Server) deleteObjects(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			log.Printf("[STORAGE] Failed to delete %s: %v", key, err)
+		}
+	}
+}
+
+// mediaURL is the stable URL an upload is served from
+func (s *Server) mediaURL(id uint) string {
+	return fmt.Sprintf("%s/api/media/%d", s.publicURL, id)
+}
+
+// renditionURLs maps the renditions of an upload to the URLs they are served from, or
+// "original" to the upload itself when it has none
+func (s *Server) renditionURLs(media *models.Media) models.Renditions {
+	if len(media.Renditions) == 0 {
+		return models.Renditions{"original": s.mediaURL(media.ID)}
+	}
+	urls := make(models.Renditions, len(media.Renditions))
+	for name := range media.Renditions {
+		urls[name] = s.mediaURL(media.ID) + "/" + name
+	}
+	return urls
+}
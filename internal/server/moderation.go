@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"obs/internal/database"
+	"obs/internal/models"
+	"obs/internal/policy"
+	"obs/internal/spam"
+	"obs/internal/types"
+	"obs/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxModerationBatch caps how many comments one bulk decision can cover
+const maxModerationBatch = 100
+
+// newCommentStatus decides whether a new comment by actor on blog is published, held for
+// moderation or rejected. The spam checker goes first, then the stricter of the site's and
+// the blog's moderation modes applies. The reason is recorded with comments that are not
+// published.
+func (s *Server) newCommentStatus(ctx context.Context, actor policy.Actor, blog *models.Blog, comment *models.Comment) (string, string, error) {
+	decision, err := s.policy.CanSkipModeration(actor, blog)
+	if err != nil {
+		return "", "", err
+	}
+	if decision.Allowed {
+		return models.CommentStatusApproved, "", nil
+	}
+
+	verdict, err := s.spam.Check(ctx, comment)
+	if err != nil {
+		log.Printf("[SPAM] Failed to check a comment by user %d: %v", actor.UserID, err)
+		return models.CommentStatusPending, "The spam check failed", nil
+	}
+	switch verdict.Action {
+	case spam.ActionReject:
+		return models.CommentStatusRejected, verdict.String(), nil
+	case spam.ActionHold:
+		return models.CommentStatusPending, verdict.String(), nil
+	}
+
+	settings, err := s.db.GetModerationSettings()
+	if err != nil {
+		return "", "", err
+	}
+	switch models.StricterModeration(settings.CommentModeration, blog.CommentModeration) {
+	case models.ModerationAll:
+		return models.CommentStatusPending, "All comments are moderated", nil
+	case models.ModerationFirstTime:
+		approved, err := s.db.HasApprovedComment(actor.UserID)
+		if err != nil {
+			return "", "", err
+		}
+		if !approved {
+			return models.CommentStatusPending, "First comments are moderated", nil
+		}
+	}
+	return models.CommentStatusApproved, "", nil
+}
+
+// editedCommentStatus decides the status of a comment after actor edits its content,
+// the same way as for a new comment. Edits only ever hold back or reject a comment:
+// comments awaiting moderation stay queued, and moderators' rejections stand. It returns
+// an empty status when the comment keeps its own.
+func (s *Server) editedCommentStatus(ctx context.Context, actor policy.Actor, comment *models.Comment, content string) (string, string, error) {
+	if comment.Status != models.CommentStatusApproved && comment.Status != models.CommentStatusPending {
+		return "", "", nil
+	}
+	blog, err := s.db.GetBlog(comment.BlogID)
+	if err != nil {
+		return "", "", err
+	}
+	if blog == nil {
+		return "", "", nil
+	}
+
+	edited := *comment
+	edited.Content = content
+	status, reason, err := s.newCommentStatus(ctx, actor, blog, &edited)
+	if err != nil {
+		return "", "", err
+	}
+	if status == models.CommentStatusApproved || status == comment.Status {
+		return "", "", nil
+	}
+	if comment.Status == models.CommentStatusPending && status != models.CommentStatusRejected {
+		return "", "", nil
+	}
+	return status, "Edited: " + reason, nil
+}
+
+// GetModerationQueue lists the comments in a moderation state, ?status= defaulting to
+// pending, oldest first
+func (s *Server) GetModerationQueue(c *gin.Context) {
+	status := c.DefaultQuery("status", models.CommentStatusPending)
+	if !models.IsValidCommentStatus(status) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Unknown comment status: " + status}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	q, ok := listQuery(c, database.ModerationQueueSpec)
+	if !ok {
+		return
+	}
+
+	comments, meta, err := s.db.GetModerationQueue(status, q)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Moderation queue retrieved successfully", Data: map[string]any{"comments": comments}, Meta: meta}
+	c.JSON(http.StatusOK, res)
+}
+
+// ModerateComments approves, rejects, hides or requeues comments in bulk. Rejecting and
+// hiding need a reason, which is recorded with each decision. Approved and rejected
+// comments train the spam checker, so comments removed for other reasons than spam
+// should be hidden instead.
+func (s *Server) ModerateComments(c *gin.Context) {
+	var input struct {
+		CommentIDs []uint `json:"comment_ids" binding:"required,min=1"`
+		Status     string `json:"status" binding:"required"`
+		Reason     string `json:"reason" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if !models.IsValidCommentStatus(input.Status) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Unknown comment status: " + input.Status}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if len(input.CommentIDs) > maxModerationBatch {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Too many comments in one decision"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if input.Reason == "" && (input.Status == models.CommentStatusRejected || input.Status == models.CommentStatusHidden) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "A reason is required to reject or hide comments"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	comments, err := s.db.ModerateComments(input.CommentIDs, input.Status, input.Reason, c.GetUint("user_id"))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	if input.Status == models.CommentStatusApproved || input.Status == models.CommentStatusRejected {
+		for i := range comments {
+			if err := s.spam.Learn(c.Request.Context(), &comments[i], input.Status == models.CommentStatusRejected); err != nil {
+				log.Printf("[SPAM] Failed to learn from comment %d: %v", comments[i].ID, err)
+			}
+		}
+	}
+
+	// Report the comments that were missing or already in the state as skipped
+	moderated := make(map[uint]bool, len(comments))
+	ids := make([]uint, 0, len(comments))
+	for _, comment := range comments {
+		moderated[comment.ID] = true
+		ids = append(ids, comment.ID)
+	}
+	skipped := []uint{}
+	for _, id := range input.CommentIDs {
+		if !moderated[id] {
+			skipped = append(skipped, id)
+			moderated[id] = true
+		}
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Comments moderated successfully", Data: map[string]any{"status": input.Status, "moderated": ids, "skipped": skipped}}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetCommentDecisions lists the moderation decisions made on a comment
+func (s *Server) GetCommentDecisions(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid comment ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	decisions, err := s.db.GetCommentDecisions(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Decisions retrieved successfully", Data: map[string]any{"decisions": decisions}}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetModerationSettings returns the site's moderation settings
+func (s *Server) GetModerationSettings(c *gin.Context) {
+	settings, err := s.db.GetModerationSettings()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Moderation settings retrieved successfully", Data: map[string]any{"settings": settings, "modes": models.ModerationModes}}
+	c.JSON(http.StatusOK, res)
+}
+
+// UpdateModerationSettings changes the site's moderation settings
+func (s *Server) UpdateModerationSettings(c *gin.Context) {
+	var input struct {
+		CommentModeration string `json:"comment_moderation" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if !models.IsValidModerationMode(input.CommentModeration) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Unknown moderation mode: " + input.CommentModeration}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	settings := models.ModerationSettings{CommentModeration: input.CommentModeration}
+	if err := s.db.UpdateModerationSettings(&settings); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Moderation settings updated successfully", Data: map[string]any{"settings": settings}}
+	c.JSON(http.StatusOK, res)
+}
+
+// SetBlogCommentModeration changes the moderation mode of the comments on a blog. The
+// site's mode still applies when it is stricter.
+func (s *Server) SetBlogCommentModeration(c *gin.Context) {
+	var input struct {
+		CommentModeration string `json:"comment_moderation" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if !models.IsValidModerationMode(input.CommentModeration) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Unknown moderation mode: " + input.CommentModeration}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	blog, ok := s.editableBlog(c)
+	if !ok {
+		return
+	}
+
+	err := s.db.SetBlogCommentModeration(blog.ID, input.CommentModeration)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Comment moderation updated successfully", Data: map[string]any{"blog_id": blog.ID, "comment_moderation": input.CommentModeration}}
+	c.JSON(http.StatusOK, res)
+}
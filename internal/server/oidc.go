@@ -0,0 +1,330 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"obs/internal/database"
+	"obs/internal/models"
+	"obs/internal/oidc"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// oidcStateCookie carries the signed state of an in-flight provider login
+	oidcStateCookie = "oidc_state"
+	// oidcStateTTL is how long the user has to finish signing in at the provider
+	oidcStateTTL = 10 * time.Minute
+)
+
+// oidcStateClaims is the signed content of the state cookie. It binds the
+// callback to the browser that started the flow.
+type oidcStateClaims struct {
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	LinkUserID uint   `json:"link_user_id,omitempty"` // Set when an existing user is linking an identity
+	jwt.RegisteredClaims
+}
+
+// GetAuthProviders lists the configured external login providers
+func (s *Server) GetAuthProviders(c *gin.Context) {
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Providers fetched successfully", Data: map[string]any{"providers": s.oidc.Names()}}
+	c.JSON(http.StatusOK, res)
+}
+
+// OIDCLogin redirects the user to the provider to sign in
+func (s *Server) OIDCLogin(c *gin.Context) {
+	s.startOIDCFlow(c, 0)
+}
+
+// LinkIdentity redirects the current user to the provider to link it to their account
+func (s *Server) LinkIdentity(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+	s.startOIDCFlow(c, userID.(uint))
+}
+
+// startOIDCFlow stores state, nonce and PKCE verifier in a signed cookie and redirects to the provider
+func (s *Server) startOIDCFlow(c *gin.Context, linkUserID uint) {
+	provider, ok := s.oidc[c.Param("provider")]
+	if !ok {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Unknown login provider"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	state, errState := utils.GenerateToken(24)
+	nonce, errNonce := utils.GenerateToken(24)
+	verifier, errVerifier := utils.GenerateToken(48)
+	if err := errors.Join(errState, errNonce, errVerifier); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadGateway, Success: false, Message: "Login provider unavailable", Error: err.Error()}
+		c.JSON(http.StatusBadGateway, res)
+		return
+	}
+
+	stateToken, err := utils.SignClaims(utils.TokenTypeOIDCState, oidcStateClaims{
+		Provider:   provider.Name(),
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateToken,
+		HttpOnly: true,
+		Secure:   false,
+		Path:     "/api",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		SameSite: http.SameSiteLaxMode, // Lax so the cookie survives the top-level redirect back from the provider
+	})
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes the provider login: it validates state and nonce, exchanges the
+// code and then either links the identity or logs the user in, creating them if needed
+func (s *Server) OIDCCallback(c *gin.Context) {
+	provider, ok := s.oidc[c.Param("provider")]
+	if !ok {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Unknown login provider"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Login was cancelled or denied", Error: errCode}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	stateToken, err := c.Cookie(oidcStateCookie)
+	var state oidcStateClaims
+	if err != nil || utils.ParseClaims(stateToken, utils.TokenTypeOIDCState, &state) != nil || state.Provider != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(c.Query("state"))) != 1 {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid or expired login state"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	// The state is single use
+	http.SetCookie(c.Writer, &http.Cookie{Name: oidcStateCookie, Value: "", HttpOnly: true, Path: "/api", MaxAge: -1, SameSite: http.SameSiteLaxMode})
+
+	token, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.Verifier)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadGateway, Success: false, Message: "Failed to complete login with provider", Error: err.Error()}
+		c.JSON(http.StatusBadGateway, res)
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), token.IDToken, state.Nonce)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid identity token", Error: err.Error()}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	identity, err := s.db.GetIdentity(provider.Name(), claims.Subject)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		s.finishIdentityLink(c, provider.Name(), state.LinkUserID, identity, claims)
+		return
+	}
+
+	user, status, err := s.userForIdentity(provider.Name(), identity, claims)
+	if err != nil {
+		res := types.Response{StatusCode: status, Success: false, Message: err.Error()}
+		c.JSON(status, res)
+		return
+	}
+
+	if user.IsTwoFactorEnabled() {
+		s.challengeTwoFactor(c, user)
+		return
+	}
+	s.completeLogin(c, user)
+}
+
+// finishIdentityLink attaches the provider identity to the user who started the link flow
+func (s *Server) finishIdentityLink(c *gin.Context, provider string, userID uint, identity *models.Identity, claims *oidc.IDTokenClaims) {
+	if identity != nil {
+		if identity.UserID == userID {
+			res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Identity already linked"}
+			c.JSON(http.StatusOK, res)
+			return
+		}
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "This identity is already linked to another account"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+
+	identity = &models.Identity{UserID: userID, Provider: provider, Subject: claims.Subject, Email: claims.Email}
+	if err := s.db.CreateIdentity(identity); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to link identity", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Identity linked successfully", Data: map[string]any{"identity": identity}}
+	c.JSON(http.StatusOK, res)
+}
+
+// userForIdentity resolves the user behind a provider identity, creating a new account for
+// unknown identities. An identity is never linked to an existing account here, even when
+// the provider vouches for the email address: the owner has to log in and link it.
+func (s *Server) userForIdentity(provider string, identity *models.Identity, claims *oidc.IDTokenClaims) (*models.User, int, error) {
+	if identity != nil {
+		user, err := s.db.GetUser(identity.UserID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("database error")
+		}
+		if user == nil {
+			return nil, http.StatusUnauthorized, errors.New("linked account no longer exists")
+		}
+		return user, http.StatusOK, nil
+	}
+
+	if claims.Email == "" {
+		return nil, http.StatusBadRequest, errors.New("the provider did not share an email address")
+	}
+
+	identity = &models.Identity{Provider: provider, Subject: claims.Subject, Email: claims.Email}
+
+	existing, err := s.db.GetUserByEmail(claims.Email)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("database error")
+	}
+	if existing != nil {
+		return nil, http.StatusConflict, errors.New("an account with this email already exists, log in and link the provider from your account settings")
+	}
+
+	// Accounts created through a provider get an unusable random password;
+	// the user can set a real one through the password reset flow
+	randomPassword, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("error generating password")
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("error generating password")
+	}
+
+	user := &models.User{
+		Username: oidcUsername(claims),
+		Email:    claims.Email,
+		Password: string(hashedPassword),
+	}
+	if claims.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := s.db.CreateUserWithIdentity(user, identity); err != nil {
+		log.Printf("[AUTH] Failed to create user from %s identity: %v", provider, err)
+		return nil, http.StatusInternalServerError, errors.New("error creating user")
+	}
+	return user, http.StatusOK, nil
+}
+
+// GetIdentities lists the external identities linked to the current user
+func (s *Server) GetIdentities(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	identities, err := s.db.GetUserIdentities(userID.(uint))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Identities fetched successfully", Data: map[string]any{"identities": identities}}
+	c.JSON(http.StatusOK, res)
+}
+
+// UnlinkIdentity removes a provider identity from the current user
+func (s *Server) UnlinkIdentity(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	err := s.db.DeleteIdentity(userID.(uint), c.Param("provider"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Identity not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if errors.Is(err, database.ErrLastLoginMethod) {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "Set a password or link another provider before unlinking your only login method"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to unlink identity", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Identity unlinked successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// oidcUsername picks a display name for a user created from an ID token
+func oidcUsername(claims *oidc.IDTokenClaims) string {
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Name
+	}
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+	if len([]rune(username)) < 3 {
+		username = "user_" + username
+	}
+	if runes := []rune(username); len(runes) > 100 {
+		username = string(runes[:100])
+	}
+	return username
+}
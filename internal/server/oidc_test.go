@@ -0,0 +1,199 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"obs/internal/database"
+	"obs/internal/models"
+	"obs/internal/oidc"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is an OpenID Connect provider that signs in whoever it is told to. The ID
+// token it hands out carries the nonce of the last authorization request.
+type mockIssuer struct {
+	*httptest.Server
+	key ed25519.PrivateKey
+
+	mu      sync.Mutex
+	nonce   string
+	subject string
+	email   string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Discovery{
+			Issuer:                issuer.URL,
+			AuthorizationEndpoint: issuer.URL + "/authorize",
+			TokenEndpoint:         issuer.URL + "/token",
+			JWKSURI:               issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		public := issuer.key.Public().(ed25519.PublicKey)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "OKP", "crv": "Ed25519", "use": "sig", "kid": "mock", "x": base64.RawURLEncoding.EncodeToString(public)},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+			"iss":            issuer.URL,
+			"aud":            "client",
+			"sub":            issuer.subject,
+			"email":          issuer.email,
+			"email_verified": true,
+			"nonce":          issuer.nonce,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "mock"
+		idToken, err := token.SignedString(issuer.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(oidc.TokenResponse{AccessToken: "access", TokenType: "Bearer", IDToken: idToken})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// signIn makes the issuer sign in the given account on its next token request
+func (m *mockIssuer) signIn(subject, email string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subject, m.email = subject, email
+}
+
+// identityDB keeps users and identities in memory. The rest of database.Service is left
+// nil, so the test fails loudly if the login flow reaches for anything else.
+type identityDB struct {
+	database.Service
+	users      map[string]*models.User
+	identities []models.Identity
+}
+
+func (db *identityDB) GetIdentity(provider, subject string) (*models.Identity, error) {
+	for _, identity := range db.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *identityDB) GetUserByEmail(email string) (*models.User, error) {
+	return db.users[email], nil
+}
+
+func (db *identityDB) CreateIdentity(identity *models.Identity) error {
+	db.identities = append(db.identities, *identity)
+	return nil
+}
+
+// runOIDCFlow starts a provider login at path as userID, or anonymously when it is 0,
+// follows the redirect through the issuer and returns the callback's response
+func runOIDCFlow(t *testing.T, s *Server, issuer *mockIssuer, path string, userID uint) *httptest.ResponseRecorder {
+	t.Helper()
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if userID != 0 {
+			c.Set("user_id", userID)
+		}
+	})
+	router.GET("/api/auth/:provider/login", s.OIDCLogin)
+	router.GET("/api/auth/:provider/callback", s.OIDCCallback)
+	router.GET("/api/user/account/identities/:provider/link", s.LinkIdentity)
+
+	start := httptest.NewRecorder()
+	router.ServeHTTP(start, httptest.NewRequest(http.MethodGet, path, nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("starting the flow returned %d: %s", start.Code, start.Body)
+	}
+	authURL, err := url.Parse(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.mu.Lock()
+	issuer.nonce = authURL.Query().Get("nonce")
+	issuer.mu.Unlock()
+
+	callback := httptest.NewRequest(http.MethodGet, "/api/auth/mock/callback?code=code&state="+url.QueryEscape(authURL.Query().Get("state")), nil)
+	for _, cookie := range start.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, callback)
+	return res
+}
+
+func newOIDCTestServer(t *testing.T, issuer *mockIssuer) (*Server, *identityDB) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	db := &identityDB{users: map[string]*models.User{
+		"jane@example.com": {ID: 1, Username: "jane", Email: "jane@example.com"},
+	}}
+	provider := oidc.NewProvider(oidc.Config{
+		Name:        "mock",
+		Issuer:      issuer.URL,
+		ClientID:    "client",
+		RedirectURL: "http://localhost/api/auth/mock/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+	return &Server{db: db, oidc: oidc.Registry{"mock": provider}}, db
+}
+
+func TestOIDCLoginDoesNotLinkExistingAccount(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s, db := newOIDCTestServer(t, issuer)
+
+	// The provider vouches for the address, but that alone must not hand over the account
+	issuer.signIn("attacker", "jane@example.com")
+	res := runOIDCFlow(t, s, issuer, "/api/auth/mock/login", 0)
+
+	if res.Code != http.StatusConflict {
+		t.Fatalf("login with the email of an existing account returned %d, want %d: %s", res.Code, http.StatusConflict, res.Body)
+	}
+	if len(db.identities) != 0 {
+		t.Fatalf("identity was linked without the account owner logging in: %+v", db.identities)
+	}
+}
+
+func TestOIDCLinkRequiresLoggedInUser(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s, db := newOIDCTestServer(t, issuer)
+
+	issuer.signIn("jane-at-mock", "jane@example.com")
+	res := runOIDCFlow(t, s, issuer, "/api/user/account/identities/mock/link", 1)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("linking returned %d: %s", res.Code, res.Body)
+	}
+	if len(db.identities) != 1 || db.identities[0].UserID != 1 || db.identities[0].Subject != "jane-at-mock" {
+		t.Fatalf("identity was not linked to the logged in user: %+v", db.identities)
+	}
+}
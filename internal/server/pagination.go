@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"obs/internal/database"
+	"obs/internal/pagination"
+	"obs/internal/types"
+
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listQuery parses the pagination parameters of a list request, responding with 400 when they are invalid
+func listQuery(c *gin.Context, spec pagination.Spec) (pagination.Query, bool) {
+	q, err := pagination.Parse(c, spec)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid list parameters", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return q, false
+	}
+	return q, true
+}
+
+// blogIncludes parses ?include=comments,likes,views, the relations a blog listing should
+// expand beyond their counts, responding with 400 for unknown relations
+func blogIncludes(c *gin.Context) ([]string, bool) {
+	var include []string
+	for _, name := range strings.Split(c.Query("include"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := database.BlogIncludes[name]; !ok {
+			res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid list parameters", Error: fmt.Sprintf("unsupported include %q", name)}
+			c.JSON(http.StatusBadRequest, res)
+			return nil, false
+		}
+		include = append(include, name)
+	}
+	return include, true
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"obs/internal/mailer"
+	"obs/internal/models"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = time.Hour
+
+// ForgotPassword emails a password reset link. It responds the same way whether
+// or not the email is registered so it cannot be used to discover accounts.
+func (s *Server) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "If the email is registered, a reset link has been sent"}
+
+	user, err := s.db.GetUserByEmail(input.Email)
+	if err != nil {
+		log.Printf("[DATABASE] Error checking user existence: %v", err)
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	reset := models.PasswordReset{UserID: user.ID, TokenHash: utils.HashToken(token), ExpiresAt: time.Now().Add(passwordResetTTL)}
+	if err := s.db.CreatePasswordReset(&reset); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.frontendURL, url.QueryEscape(token))
+	s.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"Use the link below to choose a new one. It expires in %d minutes.\n\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.", user.Username, int(passwordResetTTL.Minutes()), link),
+	})
+
+	c.JSON(http.StatusOK, res)
+}
+
+// ResetPassword sets a new password using a reset token, logs the user out everywhere and
+// revokes their personal access tokens
+func (s *Server) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Internal server error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	_, err = s.db.ResetPassword(utils.HashToken(input.Token), string(hashedPassword))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid or expired reset token"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to reset password", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	clearAuthCookies(c)
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Password reset successfully, please log in again"}
+	c.JSON(http.StatusOK, res)
+}
+
+// sendMail delivers an email in the background so slow mail servers don't block the request
+func (s *Server) sendMail(msg mailer.Message) {
+	go func() {
+		if err := s.mailer.Send(msg); err != nil {
+			log.Printf("[MAILER] Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
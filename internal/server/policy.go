@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"obs/internal/policy"
+	"obs/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireActor returns the authenticated actor, responding with 401 when there is none
+func requireActor(c *gin.Context) (policy.Actor, bool) {
+	actor, ok := policy.ActorFromContext(c)
+	if !ok {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "User not authenticated"}
+		c.JSON(http.StatusUnauthorized, res)
+		return policy.Actor{}, false
+	}
+	return actor, true
+}
+
+// authorize responds with 403 when a policy check denied the action, or 500 when it
+// failed, and reports whether the handler may continue
+func authorize(c *gin.Context, decision policy.Decision, err error) bool {
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return false
+	}
+	if !decision.Allowed {
+		res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Access denied, " + decision.Reason}
+		c.JSON(http.StatusForbidden, res)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"obs/internal/imaging"
+	"obs/internal/models"
+	"obs/internal/storage"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// mediaProcessorInterval is how often pending uploads are looked for when no upload
+// wakes the processor, which picks up uploads left over from a restart
+const mediaProcessorInterval = time.Minute
+
+// mediaProcessorBatch is how many pending uploads are claimed at a time
+const mediaProcessorBatch = 10
+
+// mediaClaimTimeout is how long a claimed upload is left to its processor. Uploads that
+// failed or whose processor stopped are claimed again after it, so it also spaces retries.
+const mediaClaimTimeout = 5 * time.Minute
+
+// maxMediaAttempts is how often an upload is tried before it is marked failed
+const maxMediaAttempts = 5
+
+// runMediaProcessor makes the renditions of uploaded avatars and covers in the background,
+// one upload at a time to bound memory use, until ctx is cancelled
+func (s *Server) runMediaProcessor(ctx context.Context) {
+	ticker := time.NewTicker(mediaProcessorInterval)
+	defer ticker.Stop()
+
+	for {
+		s.processPendingMedia(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("[MEDIA] Stopped")
+			return
+		case <-ticker.C:
+		case <-s.mediaWake:
+		}
+	}
+}
+
+// wakeMediaProcessor asks the processor to look for pending uploads now
+func (s *Server) wakeMediaProcessor() {
+	select {
+	case s.mediaWake <- struct{}{}:
+	default: // Already awake
+	}
+}
+
+// processPendingMedia processes uploads until none are pending. An upload that fails
+// keeps its claim until it goes stale, so it is skipped until then and retried after.
+func (s *Server) processPendingMedia(ctx context.Context) {
+	for ctx.Err() == nil {
+		pending, err := s.db.ClaimPendingMedia(mediaProcessorBatch, time.Now().Add(-mediaClaimTimeout))
+		if err != nil {
+			log.Printf("[MEDIA] Failed to claim pending uploads: %v", err)
+			return
+		}
+		if len(pending) == 0 {
+			return
+		}
+		for i := range pending {
+			media := &pending[i]
+			if media.Attempts > maxMediaAttempts {
+				err = s.failMedia(ctx, media, fmt.Errorf("processing failed %d times", maxMediaAttempts))
+			} else {
+				err = s.processMedia(ctx, media)
+			}
+			if err != nil {
+				log.Printf("[MEDIA] Failed to process upload %d (attempt %d): %v", media.ID, media.Attempts, err)
+			}
+		}
+	}
+}
+
+// processMedia makes the renditions of a claimed upload and puts it in place. The original
+// is deleted afterwards, so its metadata is never served. Images that cannot be processed
+// are marked failed; other errors are returned for the upload to be retried. Renditions
+// are named after the attempt, so a processor whose claim went stale never touches the
+// files of the one that claimed the upload again.
+func (s *Server) processMedia(ctx context.Context, media *models.Media) error {
+	body, _, err := s.storage.Get(ctx, media.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return s.failMedia(ctx, media, errors.New("the uploaded file is missing"))
+	}
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, media.Size+1))
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	renditions, size, err := imaging.Process(data, media.Kind == models.MediaKindAvatar)
+	if err != nil {
+		return s.failMedia(ctx, media, err)
+	}
+
+	base := strings.TrimSuffix(media.Key, path.Ext(media.Key))
+	media.Renditions = models.Renditions{}
+	media.Width, media.Height = size.X, size.Y
+	media.Size = 0
+	var stored []string
+	for _, r := range renditions {
+		key := fmt.Sprintf("%s_%d_%s.jpg", base, media.Attempts, r.Name)
+		if err := s.storage.Put(ctx, key, bytes.NewReader(r.Data), int64(len(r.Data)), imaging.ContentType); err != nil {
+			s.deleteObjects(ctx, stored...)
+			return err
+		}
+		stored = append(stored, key)
+		media.Renditions[r.Name] = key
+		media.Size += int64(len(r.Data))
+	}
+
+	replaced, err := s.db.CompleteMedia(media, s.mediaURL(media.ID), s.renditionURLs(media))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Deleted, which removed the original too, or claimed again by another processor
+		// that owns the original now: only this attempt's renditions are ours to remove
+		s.deleteObjects(ctx, stored...)
+		return nil
+	}
+	if err != nil {
+		s.deleteObjects(ctx, stored...)
+		return err
+	}
+
+	s.deleteObjects(ctx, media.Key)
+	for _, old := range replaced {
+		s.deleteObjects(ctx, old.StorageKeys()...)
+	}
+	return nil
+}
+
+// failMedia records why an upload could not be processed and deletes its original
+func (s *Server) failMedia(ctx context.Context, media *models.Media, cause error) error {
+	log.Printf("[MEDIA] Upload %d cannot be processed: %v", media.ID, cause)
+	err := s.db.FailMedia(media.ID, media.Attempts, cause.Error())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The original belongs to whoever deleted or claimed the upload since
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.deleteObjects(ctx, media.Key)
+	return nil
+}
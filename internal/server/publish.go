@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"obs/internal/models"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PublishBlog makes a blog public immediately
+func (s *Server) PublishBlog(c *gin.Context) {
+	s.changeBlogStatus(c, func(blog *models.Blog) string {
+		// Republishing an archived blog keeps its original publication date
+		if blog.PublishedAt == nil {
+			now := time.Now()
+			blog.PublishedAt = &now
+		}
+		blog.Status = models.BlogStatusPublished
+		blog.ScheduledAt = nil
+		return "Blog published successfully"
+	})
+}
+
+// UnpublishBlog turns a published or scheduled blog back into a draft
+func (s *Server) UnpublishBlog(c *gin.Context) {
+	s.changeBlogStatus(c, func(blog *models.Blog) string {
+		blog.Status = models.BlogStatusDraft
+		blog.PublishedAt = nil
+		blog.ScheduledAt = nil
+		return "Blog unpublished successfully"
+	})
+}
+
+// ArchiveBlog hides a blog from listings while keeping it for its author
+func (s *Server) ArchiveBlog(c *gin.Context) {
+	s.changeBlogStatus(c, func(blog *models.Blog) string {
+		blog.Status = models.BlogStatusArchived
+		blog.ScheduledAt = nil
+		return "Blog archived successfully"
+	})
+}
+
+// ScheduleBlog publishes a blog automatically at the given time
+func (s *Server) ScheduleBlog(c *gin.Context) {
+	var input struct {
+		PublishAt time.Time `json:"publish_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input, publish_at must be an RFC 3339 time", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if !input.PublishAt.After(time.Now()) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "publish_at must be in the future"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	s.changeBlogStatus(c, func(blog *models.Blog) string {
+		publishAt := input.PublishAt.UTC()
+		blog.Status = models.BlogStatusScheduled
+		blog.PublishedAt = nil
+		blog.ScheduledAt = &publishAt
+		return "Blog scheduled successfully"
+	})
+}
+
+// changeBlogStatus loads the :blog_id blog, checks the caller may publish it, applies
+// the change and responds with the updated blog
+func (s *Server) changeBlogStatus(c *gin.Context, change func(blog *models.Blog) string) {
+	id, err := utils.ParseUintParam(c, "blog_id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid blog ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+
+	blog, err := s.db.GetBlog(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching blog", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if blog == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	decision, err := s.policy.CanPublishBlog(actor, blog)
+	if !authorize(c, decision, err) {
+		return
+	}
+
+	message := change(blog)
+	err = s.db.SetBlogStatus(blog)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to update blog", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: message, Data: map[string]any{"blog": blog}}
+	c.JSON(http.StatusOK, res)
+}
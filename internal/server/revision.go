@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"obs/internal/database"
+	"obs/internal/models"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBlogRevisions lists the saved versions of a blog, newest first by default
+func (s *Server) GetBlogRevisions(c *gin.Context) {
+	blog, ok := s.editableBlog(c)
+	if !ok {
+		return
+	}
+	q, ok := listQuery(c, database.RevisionListSpec)
+	if !ok {
+		return
+	}
+
+	revisions, meta, err := s.db.GetBlogRevisions(blog.ID, q)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch revisions", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Revisions fetched successfully", Data: map[string]any{"revisions": revisions}, Meta: meta}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetBlogRevision returns one saved version of a blog with its content
+func (s *Server) GetBlogRevision(c *gin.Context) {
+	blog, ok := s.editableBlog(c)
+	if !ok {
+		return
+	}
+	revision, ok := s.findRevision(c, blog.ID, c.Param("revision"))
+	if !ok {
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Revision fetched successfully", Data: map[string]any{"revision": revision}}
+	c.JSON(http.StatusOK, res)
+}
+
+// DiffBlogRevisions returns a unified diff of the content between ?from= and ?to=
+// revisions; to defaults to the current revision
+func (s *Server) DiffBlogRevisions(c *gin.Context) {
+	blog, ok := s.editableBlog(c)
+	if !ok {
+		return
+	}
+	from, ok := s.findRevision(c, blog.ID, c.Query("from"))
+	if !ok {
+		return
+	}
+
+	var to *models.BlogRevision
+	if c.Query("to") != "" {
+		if to, ok = s.findRevision(c, blog.ID, c.Query("to")); !ok {
+			return
+		}
+	} else {
+		var err error
+		if to, err = s.db.GetLatestBlogRevision(blog.ID); err != nil {
+			res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching revision", Error: err.Error()}
+			c.JSON(http.StatusInternalServerError, res)
+			return
+		}
+		if to == nil {
+			res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Revision not found"}
+			c.JSON(http.StatusNotFound, res)
+			return
+		}
+	}
+
+	diff := utils.UnifiedDiff(
+		fmt.Sprintf("revision %d", from.Number),
+		fmt.Sprintf("revision %d", to.Number),
+		from.Content, to.Content,
+	)
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Diff computed successfully", Data: map[string]any{
+		"from":       from.Number,
+		"to":         to.Number,
+		"from_title": from.Title,
+		"to_title":   to.Title,
+		"diff":       diff,
+	}}
+	c.JSON(http.StatusOK, res)
+}
+
+// RestoreBlogRevision makes an older revision the current content of a blog
+func (s *Server) RestoreBlogRevision(c *gin.Context) {
+	blog, ok := s.editableBlog(c)
+	if !ok {
+		return
+	}
+	revision, ok := s.findRevision(c, blog.ID, c.Param("revision"))
+	if !ok {
+		return
+	}
+
+	if err := s.db.RestoreBlogRevision(blog, revision, c.GetUint("user_id")); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to restore revision", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Revision restored successfully", Data: map[string]any{"blog": blog}}
+	c.JSON(http.StatusOK, res)
+}
+
+// editableBlog loads the :blog_id blog and checks the caller may edit it, which is what
+// reading and restoring its history or changing its cover requires
+func (s *Server) editableBlog(c *gin.Context) (*models.Blog, bool) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := utils.ParseUintParam(c, "blog_id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid blog ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return nil, false
+	}
+
+	blog, err := s.db.GetBlog(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching blog", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	if blog == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Blog not found"}
+		c.JSON(http.StatusNotFound, res)
+		return nil, false
+	}
+
+	decision, err := s.policy.CanUpdateBlog(actor, blog)
+	if !authorize(c, decision, err) {
+		return nil, false
+	}
+	return blog, true
+}
+
+// findRevision loads a revision of the blog by its number, responding with 400 or 404
+func (s *Server) findRevision(c *gin.Context, blogID uint, number string) (*models.BlogRevision, bool) {
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid revision number"}
+		c.JSON(http.StatusBadRequest, res)
+		return nil, false
+	}
+
+	revision, err := s.db.GetBlogRevision(blogID, n)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching revision", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	if revision == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Revision not found"}
+		c.JSON(http.StatusNotFound, res)
+		return nil, false
+	}
+	return revision, true
+}
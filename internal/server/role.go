@@ -0,0 +1,209 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"obs/internal/models"
+	"obs/internal/types"
+	"obs/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AdminGetRoles lists the roles and the permissions each one grants (admin access only)
+func (s *Server) AdminGetRoles(c *gin.Context) {
+	grants, err := s.db.GetRolePermissions()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	roles := make(map[string][]string, len(models.Roles))
+	for _, role := range models.Roles {
+		roles[role] = []string{}
+	}
+	roles[models.RoleAdmin] = models.Permissions
+	for _, grant := range grants {
+		if grant.Role != models.RoleAdmin {
+			roles[grant.Role] = append(roles[grant.Role], grant.Permission)
+		}
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Roles retrieved successfully", Data: map[string]any{"roles": roles, "permissions": models.Permissions}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminSetUserRole assigns a role to a user (admin access only)
+func (s *Server) AdminSetUserRole(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid user ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if !models.IsValidRole(input.Role) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Unknown role: " + input.Role}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	// Keep admins from locking themselves out of the admin panel
+	if id == c.GetUint("user_id") && input.Role != models.RoleAdmin {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "You cannot change your own role"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	err = s.db.SetUserRole(id, input.Role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "User not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Role updated successfully", Data: map[string]any{"user_id": id, "role": input.Role}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminGrantPermission grants a permission to a role (admin access only)
+func (s *Server) AdminGrantPermission(c *gin.Context) {
+	role, permission, ok := rolePermissionParams(c)
+	if !ok {
+		return
+	}
+
+	if err := s.db.GrantPermission(role, permission); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Permission granted successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminRevokePermission removes a permission from a role (admin access only)
+func (s *Server) AdminRevokePermission(c *gin.Context) {
+	role, permission, ok := rolePermissionParams(c)
+	if !ok {
+		return
+	}
+
+	err := s.db.RevokePermission(role, permission)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Role does not have this permission"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Permission revoked successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// rolePermissionParams validates the :role and :permission path params. Admin
+// permissions are implicit and cannot be changed.
+func rolePermissionParams(c *gin.Context) (string, string, bool) {
+	role, permission := c.Param("role"), c.Param("permission")
+	if !models.IsValidRole(role) || role == models.RoleAdmin {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid role: " + role}
+		c.JSON(http.StatusBadRequest, res)
+		return "", "", false
+	}
+	if !models.IsValidPermission(permission) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Unknown permission: " + permission}
+		c.JSON(http.StatusBadRequest, res)
+		return "", "", false
+	}
+	return role, permission, true
+}
+
+// BanUser suspends a user and logs them out everywhere (requires user.ban)
+func (s *Server) BanUser(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid user ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	user, err := s.db.GetUser(id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if user == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "User not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if user.ID == c.GetUint("user_id") || user.Role == models.RoleAdmin {
+		res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "This user cannot be banned"}
+		c.JSON(http.StatusForbidden, res)
+		return
+	}
+
+	if err := s.db.BanUser(id, input.Reason); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "User banned successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// UnbanUser lifts a user's suspension (requires user.ban)
+func (s *Server) UnbanUser(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid user ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	err = s.db.UnbanUser(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "User not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "User unbanned successfully"}
+	c.JSON(http.StatusOK, res)
+}
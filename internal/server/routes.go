@@ -1,8 +1,11 @@
 package server
 
 import (
+	"log"
 	"net/http"
 	"obs/internal/middleware"
+	"obs/internal/models"
+	"obs/internal/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -11,6 +14,12 @@ import (
 func (s *Server) RegisterRoutes() http.Handler {
 	r := gin.Default()
 	r.RedirectTrailingSlash = true
+	// Client IPs come from X-Forwarded-For only when the request came through a
+	// proxy listed in TRUSTED_PROXIES, so clients cannot pick their own IP
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Printf("[WARNING] ⚠️ Invalid TRUSTED_PROXIES, trusting no proxies: %v", err)
+		r.SetTrustedProxies(nil)
+	}
 	// CORS configuration
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"}, // Add your frontend URL
@@ -22,6 +31,7 @@ func (s *Server) RegisterRoutes() http.Handler {
 	// Public Routes
 	r.GET("/", s.HelloWorldHandler)
 	r.GET("/health", s.healthHandler)
+	r.GET("/.well-known/jwks.json", s.jwksHandler)
 
 	api := r.Group("/api")
 	{
@@ -30,54 +40,160 @@ func (s *Server) RegisterRoutes() http.Handler {
 		{
 			public.POST("/register", s.RegisterUser) // Public Route
 			public.POST("/login", s.LoginUser)       // Public Route
+			public.POST("/login/2fa", s.LoginTwoFactor)
+			public.POST("/token/refresh", s.RefreshToken)
+			public.POST("/password/forgot", s.ForgotPassword)
+			public.POST("/password/reset", s.ResetPassword)
+			public.POST("/email/verify", s.VerifyEmail)
+
+			// External identity providers
+			public.GET("/auth/providers", s.GetAuthProviders)
+			public.GET("/auth/:provider/login", s.OIDCLogin)
+			public.GET("/auth/:provider/callback", s.OIDCCallback)
 		}
 
 		// Protected User Routes
 		protectedUser := api.Group("/user")
-		protectedUser.Use(middleware.AuthMiddleware()) // Apply middleware separately
+		protectedUser.Use(middleware.AuthMiddleware(s.db)) // Apply middleware separately
 		{
 			protectedUser.GET("/", s.GetCurrentUser)
 			protectedUser.GET("/all", s.GetUsers)
 			protectedUser.GET("/:user_id", s.GetUserById)
-			protectedUser.DELETE("/", s.DeleteCurrentUser)
-			protectedUser.PUT("/", s.UpdateCurrentUser)
-			protectedUser.POST("/follow/:target_id", s.ToggleFollow)
+			protectedUser.DELETE("/", middleware.RequireSession(), s.DeleteCurrentUser)
+			protectedUser.PUT("/", middleware.RequireSession(), s.UpdateCurrentUser)
+			protectedUser.POST("/follow/:target_id", middleware.RequireScope(models.ScopeEngagementWrite), s.ToggleFollow)
 			protectedUser.POST("/logout", s.LogoutUser)
+			protectedUser.POST("/email/verify/resend", middleware.RequireSession(), s.ResendVerificationEmail)
+
+			// Account security routes can only be used from an interactive login
+			account := protectedUser.Group("/")
+			account.Use(middleware.RequireSession())
+			{
+				account.GET("/sessions", s.GetSessions)
+				account.DELETE("/sessions", s.RevokeAllSessions)
+				account.DELETE("/sessions/:session_id", s.RevokeSession)
+
+				account.GET("/tokens", s.GetAccessTokens)
+				account.POST("/tokens", s.CreateAccessToken)
+				account.DELETE("/tokens/:token_id", s.RevokeAccessToken)
+
+				account.GET("/2fa", s.GetTwoFactorStatus)
+				account.POST("/2fa/setup", s.SetupTwoFactor)
+				account.POST("/2fa/enable", s.EnableTwoFactor)
+				account.POST("/2fa/disable", s.DisableTwoFactor)
+				account.POST("/2fa/recovery-codes", s.RegenerateRecoveryCodes)
+
+				account.GET("/identities", s.GetIdentities)
+				account.GET("/identities/:provider/link", s.LinkIdentity)
+				account.DELETE("/identities/:provider", s.UnlinkIdentity)
+			}
 		}
 
 		// Protected Blog Routes
 		blog := api.Group("/blog")
-		blog.Use(middleware.AuthMiddleware()) // Apply middleware separately
+		blog.Use(middleware.AuthMiddleware(s.db)) // Apply middleware separately
 		{
 			blog.GET("/all", s.GetAllBlogs)
-			blog.POST("/", s.CreateNewBlog)
+			blog.POST("/", middleware.RequireScope(models.ScopeBlogWrite), middleware.RequireVerifiedEmail(), s.CreateNewBlog)
 			blog.GET("/b/:blog_id", s.GetBlogByID)
-			blog.DELETE("/b/:blog_id", s.DeleteBlogByID)
-			blog.PUT("/b/:blog_id", s.UpdateBlog)
-			blog.POST("/:blog_id/view", s.UpdateViewHandler)
+			blog.GET("/u/:handle/:slug", s.GetBlogBySlug)
+			blog.GET("/tag/:tag", s.GetBlogsByTag)
+			blog.GET("/category/:category", s.GetBlogsByCategory)
+			blog.DELETE("/b/:blog_id", middleware.RequireScope(models.ScopeBlogWrite), s.DeleteBlogByID)
+			blog.PUT("/b/:blog_id", middleware.RequireScope(models.ScopeBlogWrite), s.UpdateBlog)
+			blog.POST("/b/:blog_id/publish", middleware.RequireScope(models.ScopeBlogWrite), middleware.RequireVerifiedEmail(), s.PublishBlog)
+			blog.POST("/b/:blog_id/unpublish", middleware.RequireScope(models.ScopeBlogWrite), middleware.RequireVerifiedEmail(), s.UnpublishBlog)
+			blog.POST("/b/:blog_id/schedule", middleware.RequireScope(models.ScopeBlogWrite), middleware.RequireVerifiedEmail(), s.ScheduleBlog)
+			blog.POST("/b/:blog_id/archive", middleware.RequireScope(models.ScopeBlogWrite), middleware.RequireVerifiedEmail(), s.ArchiveBlog)
+			blog.POST("/b/:blog_id/cover", middleware.RequireScope(models.ScopeBlogWrite), middleware.RequireVerifiedEmail(), s.UploadBlogCover)
+			blog.DELETE("/b/:blog_id/cover", middleware.RequireScope(models.ScopeBlogWrite), s.DeleteBlogCover)
+			blog.PUT("/b/:blog_id/moderation", middleware.RequireScope(models.ScopeBlogWrite), s.SetBlogCommentModeration)
+			blog.GET("/b/:blog_id/revisions", s.GetBlogRevisions)
+			blog.GET("/b/:blog_id/revisions/diff", s.DiffBlogRevisions)
+			blog.GET("/b/:blog_id/revisions/:revision", s.GetBlogRevision)
+			blog.POST("/b/:blog_id/revisions/:revision/restore", middleware.RequireScope(models.ScopeBlogWrite), s.RestoreBlogRevision)
+			blog.POST("/:blog_id/view", middleware.RequireScope(models.ScopeEngagementWrite), s.UpdateViewHandler)
 
-			blog.POST("/like", s.LikeBlog)
-			blog.DELETE("/unlike", s.UnlikeBlog)
+			blog.POST("/like", middleware.RequireScope(models.ScopeEngagementWrite), s.LikeBlog)
+			blog.DELETE("/unlike", middleware.RequireScope(models.ScopeEngagementWrite), s.UnlikeBlog)
 
 			// Nested Comments under a Blog
 			comments := blog.Group("/:blog_id/comments")
 			{
 				comments.GET("/", s.GetAllComments)
-				comments.POST("/", s.CreateNewComment)
+				comments.GET("/tree", s.GetCommentTree)
+				comments.POST("/", middleware.RequireScope(models.ScopeCommentWrite), middleware.RequireVerifiedEmail(), s.CreateNewComment)
+			}
+		}
+
+		// Topic Routes
+		topics := api.Group("/")
+		topics.Use(middleware.AuthMiddleware(s.db))
+		{
+			topics.GET("/tags", s.GetTags)
+			topics.GET("/tags/autocomplete", s.AutocompleteTags)
+			topics.GET("/categories", s.GetCategories)
+		}
+
+		// Media Routes; files are served without authentication so they can be embedded
+		media := api.Group("/media")
+		{
+			media.GET("/:id", s.ServeMedia)
+			media.GET("/:id/:rendition", s.ServeMedia)
+			media.GET("/files/*key", s.ServeMediaFile)
+
+			uploads := media.Group("/")
+			uploads.Use(middleware.AuthMiddleware(s.db))
+			{
+				uploads.GET("", s.GetMyMedia)
+				uploads.POST("/avatar", middleware.RequireSession(), s.UploadAvatar)
+				uploads.POST("/images", middleware.RequireScope(models.ScopeBlogWrite), middleware.RequireVerifiedEmail(), s.UploadImage)
+				uploads.DELETE("/:id", middleware.RequireScope(models.ScopeBlogWrite), s.DeleteMedia)
 			}
 		}
 
+		// Search Routes
+		search := api.Group("/search")
+		search.Use(middleware.AuthMiddleware(s.db))
+		{
+			search.GET("", s.Search)
+		}
+
 		// Protected Comment Routes
 		comment := api.Group("/comment")
-		comment.Use(middleware.AuthMiddleware()) // Apply middleware separately
+		comment.Use(middleware.AuthMiddleware(s.db)) // Apply middleware separately
 		{
-			comment.DELETE("/", s.DeleteCommentByID)
+			comment.DELETE("/", middleware.RequireScope(models.ScopeCommentWrite), s.DeleteCommentByID)
 			comment.GET("/:comment_id", s.GetCommentByID)
-			comment.PUT("/:comment_id", s.UpdateComment)
+			comment.GET("/:comment_id/thread", s.GetCommentThread)
+			comment.GET("/:comment_id/replies", s.GetCommentReplies)
+			comment.PUT("/:comment_id", middleware.RequireScope(models.ScopeCommentWrite), s.UpdateComment)
+			comment.DELETE("/:comment_id", middleware.RequireScope(models.ScopeCommentWrite), s.DeleteCommentByID)
+		}
+
+		// Moderation routes are open to any role holding the matching permission
+		moderation := api.Group("/moderation")
+		moderation.Use(middleware.AuthMiddleware(s.db), middleware.RequireScope(models.ScopeModeration))
+		{
+			moderation.GET("/comments", middleware.RequirePermission(s.db, models.PermCommentModerate), s.AdminGetComments)
+			moderation.PUT("/comment", middleware.RequirePermission(s.db, models.PermCommentModerate), s.AdminUpdateComment)
+			moderation.DELETE("/comment/:id", middleware.RequirePermission(s.db, models.PermCommentDeleteAny), s.AdminDeleteComment)
+			moderation.GET("/comments/queue", middleware.RequirePermission(s.db, models.PermCommentModerate), s.GetModerationQueue)
+			moderation.POST("/comments/decisions", middleware.RequirePermission(s.db, models.PermCommentModerate), s.ModerateComments)
+			moderation.GET("/comment/:id/decisions", middleware.RequirePermission(s.db, models.PermCommentModerate), s.GetCommentDecisions)
+			moderation.GET("/settings", middleware.RequirePermission(s.db, models.PermCommentModerate), s.GetModerationSettings)
+			moderation.PUT("/settings", middleware.RequirePermission(s.db, models.PermCommentModerate), s.UpdateModerationSettings)
+
+			moderation.PUT("/blog", middleware.RequirePermission(s.db, models.PermBlogEditAny), s.AdminUpdateBlog)
+			moderation.DELETE("/blog/:id", middleware.RequirePermission(s.db, models.PermBlogDeleteAny), s.AdminDeleteBlog)
+
+			moderation.POST("/user/:id/ban", middleware.RequirePermission(s.db, models.PermUserBan), s.BanUser)
+			moderation.DELETE("/user/:id/ban", middleware.RequirePermission(s.db, models.PermUserBan), s.UnbanUser)
 		}
+
 		// Admin Routes
 		admin := api.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware()) // Ensure only admins can access
+		admin.Use(middleware.AuthMiddleware(s.db), middleware.AdminMiddleware(), middleware.RequireScope(models.ScopeAdmin)) // Ensure only admins can access
 		{
 			admin.GET("/dashboard", s.GetAdminDashboard) // Admin dashboard route
 			admin.GET("/users", s.AdminGetUsers)         // Admin route to get all users
@@ -85,14 +201,34 @@ func (s *Server) RegisterRoutes() http.Handler {
 			admin.DELETE("/user/:id", s.AdminDeleteUser) // Admin route to delete a user
 			admin.PUT("/user", s.AdminUpdateUser)        // Admin route to update a user
 
+			admin.GET("/user/:id/sessions", s.AdminGetUserSessions)                  // Admin route to list a user's sessions
+			admin.DELETE("/user/:id/sessions", s.AdminRevokeUserSessions)            // Admin route to log a user out everywhere
+			admin.DELETE("/user/:id/sessions/:session_id", s.AdminRevokeUserSession) // Admin route to revoke one session
+
+			admin.GET("/roles", s.AdminGetRoles)                                          // Admin route to list roles and their permissions
+			admin.PUT("/user/:id/role", s.AdminSetUserRole)                               // Admin route to assign a role
+			admin.POST("/roles/:role/permissions/:permission", s.AdminGrantPermission)    // Admin route to grant a permission
+			admin.DELETE("/roles/:role/permissions/:permission", s.AdminRevokePermission) // Admin route to revoke a permission
+
+			admin.GET("/lockouts", s.AdminGetLockouts)     // Admin route to list throttled logins
+			admin.DELETE("/lockouts", s.AdminClearLockout) // Admin route to clear a login lockout
+
 			admin.GET("/blogs", s.AdminGetBlogs)         // Admin route to get all blogs
 			admin.GET("/blog/:id", s.AdminGetBlog)       // Admin route to get a single blog by ID
 			admin.DELETE("/blog/:id", s.AdminDeleteBlog) // Admin route to delete a blog
 			admin.PUT("/blog", s.AdminUpdateBlog)        // Admin route to update a blog
 
+			admin.PUT("/tags/:id", s.AdminRenameTag)               // Admin route to rename a tag
+			admin.POST("/tags/:id/merge", s.AdminMergeTags)        // Admin route to merge a tag into another
+			admin.POST("/categories", s.AdminCreateCategory)       // Admin route to create a category
+			admin.PUT("/categories/:id", s.AdminUpdateCategory)    // Admin route to update a category
+			admin.DELETE("/categories/:id", s.AdminDeleteCategory) // Admin route to delete a category
+
 			admin.GET("/comments", s.AdminGetComments)         // Admin route to get all comments
 			admin.DELETE("/comment/:id", s.AdminDeleteComment) // Admin route to delete a comment
 			admin.PUT("/comment", s.AdminUpdateComment)        // Admin route to update a comment
+
+			admin.POST("/counters/recount", s.AdminRecountCounters) // Admin route to repair drifted engagement counters
 		}
 	}
 	return r
@@ -107,3 +243,10 @@ func (s *Server) HelloWorldHandler(c *gin.Context) {
 func (s *Server) healthHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, s.db.Health())
 }
+
+// jwksHandler publishes the public keys access tokens are signed with so other
+// services can verify them without sharing a secret
+func (s *Server) jwksHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": utils.PublicJWKS()})
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// defaultSchedulerInterval is how often scheduled blogs are checked when
+// BLOG_SCHEDULER_INTERVAL is not set
+const defaultSchedulerInterval = time.Minute
+
+// runScheduler publishes scheduled blogs once their time has come, until ctx is cancelled
+func (s *Server) runScheduler(ctx context.Context) {
+	interval := defaultSchedulerInterval
+	if v, err := time.ParseDuration(os.Getenv("BLOG_SCHEDULER_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.publishScheduledBlogs()
+
+		select {
+		case <-ctx.Done():
+			log.Println("[SCHEDULER] Stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishScheduledBlogs runs one scheduler pass
+func (s *Server) publishScheduledBlogs() {
+	published, err := s.db.PublishScheduledBlogs(time.Now())
+	if err != nil {
+		log.Printf("[SCHEDULER] Failed to publish scheduled blogs: %v", err)
+		return
+	}
+	if published > 0 {
+		log.Printf("[SCHEDULER] Published %d scheduled blog(s)", published)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"obs/internal/database"
+	"obs/internal/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// searchDefaultLimit is the page size when ?limit= is not given
+	searchDefaultLimit = 20
+	// searchMaxLimit caps ?limit= so a single search stays cheap
+	searchMaxLimit = 50
+	// searchMaxQueryLength rejects queries long enough to be abusive
+	searchMaxQueryLength = 200
+)
+
+// Search types accepted by ?type=
+const (
+	searchTypeBlogs    = "blogs"
+	searchTypeComments = "comments"
+	searchTypeAll      = "all"
+)
+
+// Search runs a full-text search over blogs and comments the caller may see.
+// Query parameters: q (required), type (blogs, comments or all), author, tag, from, to, limit, offset.
+func (s *Server) Search(c *gin.Context) {
+	filters, searchType, err := searchFiltersFromQuery(c)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid search", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	data := map[string]any{"query": filters.Query, "limit": filters.Limit, "offset": filters.Offset}
+
+	if searchType == searchTypeBlogs || searchType == searchTypeAll {
+		blogs, mode, err := s.db.SearchBlogs(filters)
+		if err != nil {
+			res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to search blogs", Error: err.Error()}
+			c.JSON(http.StatusInternalServerError, res)
+			return
+		}
+		data["blogs"] = blogs
+		data["blogs_mode"] = mode
+	}
+
+	if searchType == searchTypeComments || searchType == searchTypeAll {
+		comments, mode, err := s.db.SearchComments(filters)
+		if err != nil {
+			res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to search comments", Error: err.Error()}
+			c.JSON(http.StatusInternalServerError, res)
+			return
+		}
+		data["comments"] = comments
+		data["comments_mode"] = mode
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Search completed successfully", Data: data}
+	c.JSON(http.StatusOK, res)
+}
+
+// searchFiltersFromQuery validates the search query parameters
+func searchFiltersFromQuery(c *gin.Context) (database.SearchFilters, string, error) {
+	filters := database.SearchFilters{
+		Query:    strings.TrimSpace(c.Query("q")),
+		Author:   strings.TrimSpace(c.Query("author")),
+		Tag:      strings.TrimSpace(c.Query("tag")),
+		ViewerID: c.GetUint("user_id"),
+		Limit:    searchDefaultLimit,
+	}
+
+	if filters.Query == "" {
+		return filters, "", fmt.Errorf("q is required")
+	}
+	if len(filters.Query) > searchMaxQueryLength {
+		return filters, "", fmt.Errorf("q must be at most %d characters", searchMaxQueryLength)
+	}
+
+	searchType := c.DefaultQuery("type", searchTypeAll)
+	if searchType != searchTypeBlogs && searchType != searchTypeComments && searchType != searchTypeAll {
+		return filters, "", fmt.Errorf("type must be one of blogs, comments or all")
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return filters, "", fmt.Errorf("limit must be a positive integer")
+		}
+		filters.Limit = min(limit, searchMaxLimit)
+	}
+	if v := c.Query("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return filters, "", fmt.Errorf("offset must be a non-negative integer")
+		}
+		filters.Offset = offset
+	}
+
+	var err error
+	if filters.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		return filters, "", fmt.Errorf("from: %w", err)
+	}
+	if filters.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		return filters, "", fmt.Errorf("to: %w", err)
+	}
+	if filters.From != nil && filters.To != nil && filters.To.Before(*filters.From) {
+		return filters, "", fmt.Errorf("to must not be before from")
+	}
+
+	return filters, searchType, nil
+}
+
+// parseSearchTime accepts an RFC 3339 time or a YYYY-MM-DD date. A bare date used as the
+// end of a range covers the whole day.
+func parseSearchTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, fmt.Errorf("must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
@@ -1,30 +1,76 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 
 	"obs/internal/database"
+	"obs/internal/loginguard"
+	"obs/internal/mailer"
+	"obs/internal/oidc"
+	"obs/internal/policy"
+	"obs/internal/spam"
+	"obs/internal/storage"
 )
 
 type Server struct {
-	port int
+	port        int
+	frontendURL string
+	publicURL   string
 
-	db database.Service
+	// Upload limits in bytes
+	maxUploadSize int64
+	mediaQuota    int64
+
+	// Deepest level a reply can be nested at, top-level comments being level 0
+	commentMaxDepth int
+
+	db         database.Service
+	mailer     mailer.Mailer
+	oidc       oidc.Registry
+	loginGuard loginguard.Tracker
+	policy     *policy.Policy
+	spam       spam.SpamChecker
+	storage    storage.Storage
+	mediaWake  chan struct{} // Wakes the media processor after an upload
 }
 
 func NewServer() *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:5173"
+	}
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = fmt.Sprintf("http://localhost:%d", port)
+	}
 	NewServer := &Server{
-		port: port,
+		port:        port,
+		frontendURL: strings.TrimSuffix(frontendURL, "/"),
+		publicURL:   strings.TrimSuffix(publicURL, "/"),
 
-		db: database.New(),
+		maxUploadSize: envMegabytes("MEDIA_MAX_UPLOAD_MB", 10),
+		mediaQuota:    envMegabytes("MEDIA_QUOTA_MB", 100),
+
+		commentMaxDepth: envInt("COMMENT_MAX_DEPTH", 5),
+
+		db:        database.New(),
+		mailer:    mailer.New(),
+		oidc:      oidc.Load(),
+		mediaWake: make(chan struct{}, 1),
 	}
+	NewServer.loginGuard = loginguard.New(NewServer.db)
+	NewServer.policy = policy.New(NewServer.db)
+	NewServer.spam = spam.New(NewServer.db)
+	NewServer.storage = storage.New(NewServer.publicURL)
 
 	// Declare Server config
 	server := &http.Server{
@@ -35,5 +81,40 @@ func NewServer() *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Publish scheduled blogs in the background until the server shuts down
+	ctx, stopScheduler := context.WithCancel(context.Background())
+	server.RegisterOnShutdown(stopScheduler)
+	go NewServer.runScheduler(ctx)
+	go NewServer.runMediaProcessor(ctx)
+	go NewServer.runLoginGuardPruner(ctx)
+
 	return server
 }
+
+// trustedProxies reads the comma separated IPs and CIDRs of the reverse proxies allowed
+// to report client IPs from TRUSTED_PROXIES. None are trusted by default.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// envInt reads a positive integer from the environment
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+// envMegabytes reads a size in megabytes from the environment, returning it in bytes
+func envMegabytes(key string, fallback int64) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && v > 0 {
+		return v << 20
+	}
+	return fallback << 20
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"obs/internal/types"
+	"obs/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetSessions lists the active sessions of the current user
+func (s *Server) GetSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	sessions, err := s.db.GetUserSessions(userID.(uint))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	currentID := c.GetUint("session_id")
+	sanitizedSessions := make([]utils.SanitizedOwnSession, len(sessions))
+	for i, session := range sessions {
+		sanitizedSessions[i] = utils.SanitizedOwnSessionData(&session, currentID)
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Sessions fetched successfully", Data: map[string]any{"sessions": sanitizedSessions}}
+	c.JSON(http.StatusOK, res)
+}
+
+// RevokeSession logs the current user out of a single session
+func (s *Server) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	sessionID, err := utils.ParseUintParam(c, "session_id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid session ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	err = s.db.RevokeUserSession(userID.(uint), sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Session not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to revoke session", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	if sessionID == c.GetUint("session_id") {
+		clearAuthCookies(c)
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Session revoked successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// RevokeAllSessions logs the current user out of all devices.
+// Pass ?keep_current=true to stay logged in on the calling device.
+func (s *Server) RevokeAllSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	var exceptID uint
+	keepCurrent := c.Query("keep_current") == "true"
+	if keepCurrent {
+		exceptID = c.GetUint("session_id")
+	}
+
+	revoked, err := s.db.RevokeAllSessions(userID.(uint), exceptID)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to revoke sessions", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	if !keepCurrent {
+		clearAuthCookies(c)
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Sessions revoked successfully", Data: map[string]any{"revoked": revoked}}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"obs/internal/database"
+	"obs/internal/models"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tagAutocompleteLimit caps the number of suggestions returned by AutocompleteTags
+const tagAutocompleteLimit = 10
+
+// GetTags lists tags with the number of published blogs using each, most used first
+func (s *Server) GetTags(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	tags, err := s.db.GetTags("", limit)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch tags", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Tags fetched successfully", Data: map[string]any{"tags": tags}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AutocompleteTags suggests existing tags starting with the ?q= prefix
+func (s *Server) AutocompleteTags(c *gin.Context) {
+	prefix := strings.TrimSpace(c.Query("q"))
+	if prefix == "" {
+		res := types.Response{StatusCode: http.StatusOK, Success: true, Data: map[string]any{"tags": []models.Tag{}}}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	tags, err := s.db.GetTags(prefix, tagAutocompleteLimit)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch tags", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Data: map[string]any{"tags": tags}}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetBlogsByTag lists the blogs with the :tag slug
+func (s *Server) GetBlogsByTag(c *gin.Context) {
+	q, ok := listQuery(c, database.BlogListSpec)
+	if !ok {
+		return
+	}
+
+	include, ok := blogIncludes(c)
+	if !ok {
+		return
+	}
+
+	blogs, meta, err := s.db.GetBlogsByTag(c.Param("tag"), c.GetUint("user_id"), q, include)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch blogs", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blogs fetched successfully", Data: map[string]any{"blogs": blogs}, Meta: meta}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetCategories returns the category hierarchy as a tree
+func (s *Server) GetCategories(c *gin.Context) {
+	categories, err := s.db.GetCategories()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch categories", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Categories fetched successfully", Data: map[string]any{"categories": categoryTree(categories, nil)}}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetBlogsByCategory lists the blogs in the :category slug and its subcategories
+func (s *Server) GetBlogsByCategory(c *gin.Context) {
+	category, err := s.db.GetCategoryBySlug(c.Param("category"))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error fetching category", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if category == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Category not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	q, ok := listQuery(c, database.BlogListSpec)
+	if !ok {
+		return
+	}
+
+	include, ok := blogIncludes(c)
+	if !ok {
+		return
+	}
+
+	blogs, meta, err := s.db.GetBlogsByCategory(category.ID, c.GetUint("user_id"), q, include)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to fetch blogs", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Blogs fetched successfully", Data: map[string]any{"category": category, "blogs": blogs}, Meta: meta}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminRenameTag renames a tag (admin access only)
+func (s *Server) AdminRenameTag(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid tag ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	var input struct {
+		Name string `json:"name" binding:"required,min=1,max=50"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	tag, err := s.db.RenameTag(id, input.Name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Tag not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if errors.Is(err, database.ErrTagExists) {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "A tag with this name already exists, merge the tags instead"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Tag renamed successfully", Data: map[string]any{"tag": tag}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminMergeTags moves every blog from the :id tag to the "into" tag and deletes the :id tag (admin access only)
+func (s *Server) AdminMergeTags(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid tag ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	var input struct {
+		Into uint `json:"into" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if input.Into == id {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "A tag cannot be merged into itself"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	err = s.db.MergeTags(id, input.Into)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Tag not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	tag, err := s.db.GetTag(input.Into)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Tags merged successfully", Data: map[string]any{"tag": tag}}
+	c.JSON(http.StatusOK, res)
+}
+
+// categoryInput is the request body for creating and updating categories
+type categoryInput struct {
+	Name        string `json:"name" binding:"required,min=1,max=100"`
+	Description string `json:"description"`
+	ParentID    *uint  `json:"parent_id"`
+}
+
+// AdminCreateCategory adds a category (admin access only)
+func (s *Server) AdminCreateCategory(c *gin.Context) {
+	var input categoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	parentID, ok := s.checkCategory(c, input.ParentID)
+	if !ok {
+		return
+	}
+	category := models.Category{Name: strings.TrimSpace(input.Name), Slug: utils.TopicSlug(input.Name), Description: input.Description, ParentID: parentID}
+	if !s.checkCategorySlug(c, category.Slug, 0) {
+		return
+	}
+
+	if err := s.db.CreateCategory(&category); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusCreated, Success: true, Message: "Category created successfully", Data: map[string]any{"category": category}}
+	c.JSON(http.StatusCreated, res)
+}
+
+// AdminUpdateCategory renames, describes or moves a category (admin access only)
+func (s *Server) AdminUpdateCategory(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid category ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	var input categoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	parentID, ok := s.checkCategory(c, input.ParentID)
+	if !ok {
+		return
+	}
+	category := models.Category{ID: id, Name: strings.TrimSpace(input.Name), Slug: utils.TopicSlug(input.Name), Description: input.Description, ParentID: parentID}
+	if !s.checkCategorySlug(c, category.Slug, id) {
+		return
+	}
+
+	err = s.db.UpdateCategory(&category)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Category not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if errors.Is(err, database.ErrCategoryCycle) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "A category cannot be nested under itself or its subcategories"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Category updated successfully", Data: map[string]any{"category": category}}
+	c.JSON(http.StatusOK, res)
+}
+
+// AdminDeleteCategory deletes a category without subcategories (admin access only)
+func (s *Server) AdminDeleteCategory(c *gin.Context) {
+	id, err := utils.ParseUintParam(c, "id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid category ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	err = s.db.DeleteCategory(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Category not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if errors.Is(err, database.ErrCategoryInUse) {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "Move or delete the subcategories first"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Category deleted successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// checkCategory makes sure a category ID from the request exists. Nil and 0 mean no
+// category and yield nil. Responds with 400 or 500 and returns false otherwise.
+func (s *Server) checkCategory(c *gin.Context, id *uint) (*uint, bool) {
+	if id == nil || *id == 0 {
+		return nil, true
+	}
+
+	category, err := s.db.GetCategory(*id)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	if category == nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Unknown category"}
+		c.JSON(http.StatusBadRequest, res)
+		return nil, false
+	}
+	return &category.ID, true
+}
+
+// checkCategorySlug responds with 409 and returns false when another category already has the slug
+func (s *Server) checkCategorySlug(c *gin.Context, slug string, id uint) bool {
+	existing, err := s.db.GetCategoryBySlug(slug)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return false
+	}
+	if existing != nil && existing.ID != id {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "A category with this name already exists"}
+		c.JSON(http.StatusConflict, res)
+		return false
+	}
+	return true
+}
+
+// categoryTree nests the categories under their parents, starting at parentID
+func categoryTree(categories []models.Category, parentID *uint) []models.Category {
+	tree := []models.Category{}
+	for _, category := range categories {
+		if (parentID == nil && category.ParentID == nil) || (parentID != nil && category.ParentID != nil && *category.ParentID == *parentID) {
+			category.Children = categoryTree(categories, &category.ID)
+			tree = append(tree, category)
+		}
+	}
+	return tree
+}
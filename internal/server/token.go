@@ -0,0 +1,141 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"obs/internal/models"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetAccessTokens lists the personal access tokens of the current user
+func (s *Server) GetAccessTokens(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	tokens, err := s.db.GetPersonalAccessTokens(userID.(uint))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	sanitizedTokens := make([]utils.SanitizedAccessToken, len(tokens))
+	for i, token := range tokens {
+		sanitizedTokens[i] = utils.SanitizedAccessTokenData(&token)
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Tokens fetched successfully", Data: map[string]any{"tokens": sanitizedTokens}}
+	c.JSON(http.StatusOK, res)
+}
+
+// CreateAccessToken issues a new personal access token. The plain token is only returned once.
+func (s *Server) CreateAccessToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	var input struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"` // 0 means the token never expires
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	for _, scope := range input.Scopes {
+		if !slices.Contains(models.ValidScopes, scope) {
+			res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid scope: " + scope}
+			c.JSON(http.StatusBadRequest, res)
+			return
+		}
+		if scope == models.ScopeAdmin && c.GetString("role") != models.RoleAdmin {
+			res := types.Response{StatusCode: http.StatusForbidden, Success: false, Message: "Only admins can create tokens with the admin scope"}
+			c.JSON(http.StatusForbidden, res)
+			return
+		}
+	}
+	slices.Sort(input.Scopes)
+	input.Scopes = slices.Compact(input.Scopes)
+
+	plainToken, prefix, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	token := models.PersonalAccessToken{
+		UserID:    userID.(uint),
+		Name:      input.Name,
+		TokenHash: utils.HashToken(plainToken),
+		Prefix:    prefix,
+		Scopes:    strings.Join(input.Scopes, " "),
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.db.CreatePersonalAccessToken(&token); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to create token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{
+		StatusCode: http.StatusCreated,
+		Success:    true,
+		Message:    "Token created successfully, copy it now as it will not be shown again",
+		Data:       map[string]any{"token": plainToken, "details": utils.SanitizedAccessTokenData(&token)},
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+// RevokeAccessToken revokes one of the current user's personal access tokens
+func (s *Server) RevokeAccessToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	tokenID, err := utils.ParseUintParam(c, "token_id")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid token ID", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	err = s.db.RevokePersonalAccessToken(userID.(uint), tokenID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "Token not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to revoke token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Token revoked successfully"}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"net/http"
+	"obs/internal/models"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// twoFactorLoginPurpose identifies the challenge token issued between the password and TOTP steps
+	twoFactorLoginPurpose = "two_factor_login"
+	// twoFactorLoginTTL is how long a user has to enter their code after the password step
+	twoFactorLoginTTL = 5 * time.Minute
+	// recoveryCodeCount is how many recovery codes are issued at a time
+	recoveryCodeCount = 10
+)
+
+// LoginTwoFactor completes a login for a user with 2FA using a TOTP or recovery code
+func (s *Server) LoginTwoFactor(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	claims, err := utils.VerifyPurposeToken(input.MFAToken, twoFactorLoginPurpose)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Login attempt expired, please sign in again"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	user, err := s.db.GetUser(claims.UserID)
+	if err != nil || user == nil || !user.IsTwoFactorEnabled() {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid credentials"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	keys := loginKeys(c, user.Email)
+	if !s.checkLoginAllowed(c, keys) {
+		return
+	}
+
+	ok, err := s.verifySecondFactor(user, input.Code, input.RecoveryCode)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if !ok {
+		s.recordLoginFailure(c, keys, "Invalid two-factor code")
+		return
+	}
+
+	s.resetLoginFailures(user.Email)
+	s.completeLogin(c, user)
+}
+
+// challengeTwoFactor responds with a short-lived token that LoginTwoFactor exchanges for a session
+func (s *Server) challengeTwoFactor(c *gin.Context, user *models.User) {
+	mfaToken, err := utils.CreatePurposeToken(twoFactorLoginPurpose, user.ID, user.Email, twoFactorLoginTTL)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating token", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{
+		StatusCode: http.StatusOK,
+		Success:    true,
+		Message:    "Two-factor authentication required",
+		Data:       map[string]any{"two_factor_required": true, "mfa_token": mfaToken},
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetTwoFactorStatus reports whether 2FA is enabled for the current user
+func (s *Server) GetTwoFactorStatus(c *gin.Context) {
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	remaining, err := s.db.CountRecoveryCodes(user.ID)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{
+		StatusCode: http.StatusOK,
+		Success:    true,
+		Message:    "Two-factor status fetched successfully",
+		Data:       map[string]any{"enabled": user.IsTwoFactorEnabled(), "recovery_codes_remaining": remaining},
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// SetupTwoFactor generates a new TOTP secret for the current user. 2FA is only
+// turned on once the user proves they can generate codes with EnableTwoFactor.
+func (s *Server) SetupTwoFactor(c *gin.Context) {
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.IsTwoFactorEnabled() {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "Two-factor authentication is already enabled"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating secret", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	if err := s.db.SetTOTPSecret(user.ID, secret); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "OBS"
+	}
+
+	res := types.Response{
+		StatusCode: http.StatusOK,
+		Success:    true,
+		Message:    "Scan the code with your authenticator app, then confirm it to enable two-factor authentication",
+		Data:       map[string]any{"secret": secret, "otpauth_uri": utils.TOTPURI(issuer, user.Email, secret)},
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// EnableTwoFactor confirms TOTP enrollment with a valid code and returns one-time recovery codes
+func (s *Server) EnableTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.IsTwoFactorEnabled() {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "Two-factor authentication is already enabled"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+	if user.TOTPSecret == "" {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Start two-factor setup first"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(user.TOTPSecret, input.Code, time.Now())
+	if !valid {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid two-factor code"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating recovery codes", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	if err := s.db.EnableTwoFactor(user.ID, step, hashes); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{
+		StatusCode: http.StatusOK,
+		Success:    true,
+		Message:    "Two-factor authentication enabled, store your recovery codes somewhere safe",
+		Data:       map[string]any{"recovery_codes": codes},
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// DisableTwoFactor turns 2FA off after re-checking the password and a second factor
+func (s *Server) DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.IsTwoFactorEnabled() {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "Two-factor authentication is not enabled"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+
+	if !utils.CheckPassword(input.Password, user.Password) {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid credentials"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	valid, err := s.verifySecondFactor(user, input.Code, input.RecoveryCode)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if !valid {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid two-factor code"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	if err := s.db.DisableTwoFactor(user.ID); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Two-factor authentication disabled"}
+	c.JSON(http.StatusOK, res)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the current user after checking a TOTP code
+func (s *Server) RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.IsTwoFactorEnabled() {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "Two-factor authentication is not enabled"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+
+	valid, err := s.verifySecondFactor(user, input.Code, "")
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if !valid {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Invalid two-factor code"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error generating recovery codes", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	if err := s.db.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Recovery codes regenerated", Data: map[string]any{"recovery_codes": codes}}
+	c.JSON(http.StatusOK, res)
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code if no TOTP code was given.
+// Both are single use: a TOTP step or recovery code is rejected once accepted.
+func (s *Server) verifySecondFactor(user *models.User, code, recoveryCode string) (bool, error) {
+	switch {
+	case code != "":
+		step, valid := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+		if !valid {
+			return false, nil
+		}
+		return s.db.UseTOTPStep(user.ID, step)
+	case recoveryCode != "":
+		return s.db.UseRecoveryCode(user.ID, utils.HashRecoveryCode(recoveryCode))
+	default:
+		return false, nil
+	}
+}
+
+// currentUser loads the authenticated user, writing an error response if that fails
+func (s *Server) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return nil, false
+	}
+
+	user, err := s.db.GetUser(userID.(uint))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return nil, false
+	}
+	if user == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "User not found"}
+		c.JSON(http.StatusNotFound, res)
+		return nil, false
+	}
+	return user, true
+}
+
+// newRecoveryCodes generates a set of recovery codes along with the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"obs/internal/database"
 	"obs/internal/models"
 	"obs/internal/types"
 	"obs/internal/utils"
@@ -69,7 +72,12 @@ func (s *Server) GetUserById(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 func (s *Server) GetUsers(c *gin.Context) {
-	users, err := s.db.GetUsers()
+	q, ok := listQuery(c, database.UserListSpec)
+	if !ok {
+		return
+	}
+
+	users, meta, err := s.db.GetUsers(q)
 	if err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
@@ -81,7 +89,7 @@ func (s *Server) GetUsers(c *gin.Context) {
 		sanitizedUsers[i] = utils.SanitizedUserData(&user)
 	}
 
-	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Users fetched successfully", Data: map[string]any{"users": sanitizedUsers}}
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Users fetched successfully", Data: map[string]any{"users": sanitizedUsers}, Meta: meta}
 	c.JSON(http.StatusOK, res)
 }
 
@@ -93,38 +101,74 @@ func (s *Server) UpdateCurrentUser(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var input types.UserUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
 		c.JSON(http.StatusBadRequest, res)
 		return
 	}
+	// Zero values are not updated
+	user := models.User{ID: userID.(uint), Username: input.Username, Pfp: input.Pfp, Email: input.Email}
 
-	user.ID = userID.(uint)
-
+	existing, err := s.db.GetUser(user.ID)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error updating user", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if existing == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "User not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
 	if err := s.db.UpdateUser(&user); err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Error updating user", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
+	s.reverifyEmail(user.ID, existing.Email)
 
 	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "User updated successfully"}
 	c.JSON(http.StatusOK, res)
 }
 
+// DeleteCurrentUser deletes the authenticated user's account. A user_id in the body
+// is only honoured when it matches the caller or the caller is an admin.
 func (s *Server) DeleteCurrentUser(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+
 	var input struct {
 		UserId uint `json:"user_id"`
 	}
-	if err := c.ShouldBindJSON(&input); err != nil {
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input data"})
 		return
 	}
-	if err := s.db.DeleteUser(uint(input.UserId)); err != nil {
+	if input.UserId == 0 {
+		input.UserId = actor.UserID
+	}
+
+	decision, err := s.policy.CanDeleteUser(actor, input.UserId)
+	if !authorize(c, decision, err) {
+		return
+	}
+
+	keys, err := s.db.GetUserMediaKeys(input.UserId)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to delete user", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if err := s.db.DeleteUser(input.UserId); err != nil {
 		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to delete user", Error: err.Error()}
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
+	// The media records went with the user; remove their files too
+	s.deleteObjects(c.Request.Context(), keys...)
 
 	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "User deleted successfully"}
 	c.JSON(http.StatusOK, res)
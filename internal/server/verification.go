@@ -0,0 +1,142 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"obs/internal/mailer"
+	"obs/internal/models"
+	"obs/internal/types"
+	"obs/internal/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// emailVerificationPurpose identifies email verification tokens
+	emailVerificationPurpose = "email_verification"
+	// emailVerificationTTL is how long a verification link stays valid
+	emailVerificationTTL = 24 * time.Hour
+	// verificationResendInterval is the minimum time between two verification emails
+	verificationResendInterval = time.Minute
+)
+
+// VerifyEmail confirms a user's email address using the signed token from the verification link
+func (s *Server) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid input", Error: err.Error()}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	claims, err := utils.VerifyPurposeToken(input.Token, emailVerificationPurpose)
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid or expired verification link"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	err = s.db.MarkEmailVerified(claims.UserID, claims.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		res := types.Response{StatusCode: http.StatusBadRequest, Success: false, Message: "Invalid or expired verification link"}
+		c.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Email verified successfully"}
+	c.JSON(http.StatusOK, res)
+}
+
+// ResendVerificationEmail sends a new verification link to the current user, at most once per minute
+func (s *Server) ResendVerificationEmail(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		res := types.Response{StatusCode: http.StatusUnauthorized, Success: false, Message: "Unauthorized access"}
+		c.JSON(http.StatusUnauthorized, res)
+		return
+	}
+
+	user, err := s.db.GetUser(userID.(uint))
+	if err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Database error", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	if user == nil {
+		res := types.Response{StatusCode: http.StatusNotFound, Success: false, Message: "User not found"}
+		c.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	if user.IsEmailVerified() {
+		res := types.Response{StatusCode: http.StatusConflict, Success: false, Message: "Email is already verified"}
+		c.JSON(http.StatusConflict, res)
+		return
+	}
+
+	if user.VerificationSentAt != nil {
+		if wait := verificationResendInterval - time.Since(*user.VerificationSentAt); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			res := types.Response{StatusCode: http.StatusTooManyRequests, Success: false, Message: "Please wait before requesting another verification email"}
+			c.JSON(http.StatusTooManyRequests, res)
+			return
+		}
+	}
+
+	if err := s.sendVerificationEmail(user); err != nil {
+		res := types.Response{StatusCode: http.StatusInternalServerError, Success: false, Message: "Failed to send verification email", Error: err.Error()}
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	res := types.Response{StatusCode: http.StatusOK, Success: true, Message: "Verification email sent"}
+	c.JSON(http.StatusOK, res)
+}
+
+// reverifyEmail sends a verification link to a user whose email address changed from
+// previous, which cleared their verification
+func (s *Server) reverifyEmail(userID uint, previous string) {
+	user, err := s.db.GetUser(userID)
+	if err != nil || user == nil || strings.EqualFold(user.Email, previous) {
+		return
+	}
+	if err := s.sendVerificationEmail(user); err != nil {
+		log.Printf("[AUTH] Failed to send verification email to user %d: %v", user.ID, err)
+	}
+}
+
+// sendVerificationEmail emails the user a signed verification link and records when it was sent
+func (s *Server) sendVerificationEmail(user *models.User) error {
+	token, err := utils.CreatePurposeToken(emailVerificationPurpose, user.ID, user.Email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.SetVerificationSentAt(user.ID, time.Now()); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.frontendURL, url.QueryEscape(token))
+	s.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. "+
+			"It expires in %d hours.\n\n%s", user.Username, int(emailVerificationTTL.Hours()), link),
+	})
+	return nil
+}
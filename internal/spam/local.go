@@ -0,0 +1,216 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"obs/internal/database"
+	"obs/internal/models"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Config tunes the local checker
+type Config struct {
+	Thresholds      Thresholds
+	MaxLinks        int           // Links a comment may contain before each further one raises its score
+	Blocklist       []string      // Lowercase words, phrases and domains only spam contains
+	DuplicateWindow time.Duration // How far back copies of a comment are looked for
+}
+
+// DefaultConfig is used when no environment overrides are set
+var DefaultConfig = Config{
+	Thresholds:      DefaultThresholds,
+	MaxLinks:        2,
+	Blocklist:       []string{"viagra", "cialis", "casino", "payday loan", "replica watches", "buy followers"},
+	DuplicateWindow: 24 * time.Hour,
+}
+
+// Evidence of each signal, as log-odds of the comment being spam. Without a trained
+// classifier comments start out at about 5% likely to be spam.
+const (
+	priorWeight        = -3.0
+	linkWeight         = 1.5 // Per link beyond the maximum
+	blocklistWeight    = 5.0 // For the first blocklisted term
+	blocklistWeightMax = 1.5 // For each further term
+	duplicateWeight    = 3.0 // For the first copy
+	duplicateWeightMax = 1.0 // For each further copy, up to three
+	classifierLimit    = 8.0 // Bounds the classifier's evidence either way
+)
+
+// minTraining is how many comments of each label the classifier must have been trained
+// with before its evidence is used
+const minTraining = 10
+
+// Token limits; longer tokens are mostly hashes and URLs
+const (
+	minTokenLength = 3
+	maxTokenLength = 30
+	maxTokens      = 200
+)
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'()\[\]]+`)
+
+// Local is the built-in offline checker. It adds up the evidence of a naive Bayes
+// classifier trained from moderation decisions, link counting, a blocklist and copies of
+// the comment posted recently, and turns the sum into a score.
+type Local struct {
+	db     database.Service
+	config Config
+}
+
+// NewLocal creates a checker that keeps its classifier in the database
+func NewLocal(db database.Service, config Config) *Local {
+	return &Local{db: db, config: config}
+}
+
+// Check scores a new comment
+func (l *Local) Check(ctx context.Context, comment *models.Comment) (Verdict, error) {
+	var reasons []string
+	links := Links(comment.Content)
+	tokens := Tokenize(comment.Content)
+
+	evidence := priorWeight
+	if odds, ok, err := l.classify(tokens); err != nil {
+		return Verdict{}, err
+	} else if ok {
+		evidence = odds
+		if odds > 0 {
+			reasons = append(reasons, fmt.Sprintf("looks like earlier spam (%.2f)", sigmoid(odds)))
+		}
+	}
+
+	if extra := len(links) - l.config.MaxLinks; extra > 0 {
+		evidence += linkWeight * float64(extra)
+		reasons = append(reasons, fmt.Sprintf("%d links", len(links)))
+	}
+
+	if matches := l.blocklisted(comment.Content, tokens, links); len(matches) > 0 {
+		evidence += blocklistWeight + blocklistWeightMax*float64(len(matches)-1)
+		reasons = append(reasons, "blocklisted "+strings.Join(matches, ", "))
+	}
+
+	copies, err := l.db.CountDuplicateComments(comment.Content, time.Now().Add(-l.config.DuplicateWindow), comment.ID)
+	if err != nil {
+		return Verdict{}, err
+	}
+	if copies > 0 {
+		evidence += duplicateWeight + duplicateWeightMax*float64(min(copies-1, 3))
+		reasons = append(reasons, fmt.Sprintf("already posted %d times", copies))
+	}
+
+	score := sigmoid(evidence)
+	return Verdict{Score: score, Action: l.config.Thresholds.Action(score), Reasons: reasons}, nil
+}
+
+// Learn trains the classifier with a comment a moderator rejected as spam or approved
+func (l *Local) Learn(ctx context.Context, comment *models.Comment, spam bool) error {
+	label := models.SpamLabelHam
+	if spam {
+		label = models.SpamLabelSpam
+	}
+	return l.db.TrainSpam(comment.ID, Tokenize(comment.Content), label)
+}
+
+// classify returns the log-odds of the tokens coming from spam, and false while the
+// classifier has too little training. Tokens it was never trained with are ignored.
+func (l *Local) classify(tokens []string) (float64, bool, error) {
+	counts, corpus, err := l.db.GetSpamTokens(tokens)
+	if err != nil {
+		return 0, false, err
+	}
+	if corpus.Spam < minTraining || corpus.Ham < minTraining {
+		return 0, false, nil
+	}
+
+	// Laplace smoothing keeps tokens seen with only one label from deciding alone
+	odds := math.Log(float64(corpus.Spam+1) / float64(corpus.Ham+1))
+	for _, token := range tokens {
+		count, ok := counts[token]
+		if !ok {
+			continue
+		}
+		inSpam := float64(count.Spam+1) / float64(corpus.Spam+2)
+		inHam := float64(count.Ham+1) / float64(corpus.Ham+2)
+		odds += math.Log(inSpam / inHam)
+	}
+	return max(-classifierLimit, min(odds, classifierLimit)), true, nil
+}
+
+// blocklisted returns the blocklist terms a comment contains. Domains match the hosts
+// of links and their subdomains, phrases match anywhere and words match whole tokens.
+func (l *Local) blocklisted(content string, tokens, links []string) []string {
+	var matches []string
+	lower := strings.ToLower(content)
+	for _, term := range l.config.Blocklist {
+		var found bool
+		switch {
+		case strings.Contains(term, "."):
+			found = slices.ContainsFunc(links, func(link string) bool {
+				host := linkHost(link)
+				return host == term || strings.HasSuffix(host, "."+term)
+			})
+		case strings.Contains(term, " "):
+			found = strings.Contains(lower, term)
+		default:
+			found = slices.Contains(tokens, term)
+		}
+		if found {
+			matches = append(matches, term)
+		}
+	}
+	return matches
+}
+
+// Links returns the URLs in a comment
+func Links(content string) []string {
+	return linkPattern.FindAllString(content, -1)
+}
+
+// Tokenize splits a comment into the distinct lowercase words and link hosts the
+// classifier is trained with
+func Tokenize(content string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	add := func(token string) {
+		if len(tokens) < maxTokens && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	for _, link := range Links(content) {
+		if host := linkHost(link); host != "" && len("link:"+host) <= maxTokenLength {
+			add("link:" + host)
+		}
+	}
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if n := len(word); n >= minTokenLength && n <= maxTokenLength {
+			add(word)
+		}
+	}
+	return tokens
+}
+
+// linkHost returns the lowercase host of a link, without a leading www.
+func linkHost(link string) string {
+	host := strings.ToLower(link)
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexAny(host, "/?#:"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+// sigmoid turns log-odds into a probability
+func sigmoid(odds float64) float64 {
+	return 1 / (1 + math.Exp(-odds))
+}
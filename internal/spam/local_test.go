@@ -0,0 +1,159 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"obs/internal/database"
+	"obs/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trainingDB keeps the classifier's counts in memory. The rest of database.Service is
+// left nil, so tests fail loudly if the checker reaches for anything else.
+type trainingDB struct {
+	database.Service
+	tokens   map[string]models.SpamToken
+	corpus   models.SpamCorpus
+	comments []models.Comment
+}
+
+func newTrainingDB() *trainingDB {
+	return &trainingDB{tokens: make(map[string]models.SpamToken)}
+}
+
+func (db *trainingDB) GetSpamTokens(tokens []string) (map[string]models.SpamToken, models.SpamCorpus, error) {
+	counts := make(map[string]models.SpamToken)
+	for _, token := range tokens {
+		if count, ok := db.tokens[token]; ok {
+			counts[token] = count
+		}
+	}
+	return counts, db.corpus, nil
+}
+
+func (db *trainingDB) TrainSpam(commentID uint, tokens []string, label string) error {
+	for _, token := range tokens {
+		count := db.tokens[token]
+		count.Token = token
+		if label == models.SpamLabelSpam {
+			count.Spam++
+		} else {
+			count.Ham++
+		}
+		db.tokens[token] = count
+	}
+	if label == models.SpamLabelSpam {
+		db.corpus.Spam++
+	} else {
+		db.corpus.Ham++
+	}
+	return nil
+}
+
+// CountDuplicateComments matches content the way the database's content hash does
+func (db *trainingDB) CountDuplicateComments(content string, since time.Time, excludeID uint) (int64, error) {
+	normalize := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), " ")) }
+	var count int64
+	for _, comment := range db.comments {
+		if comment.ID != excludeID && normalize(comment.Content) == normalize(content) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func TestCheckUsesTrainedClassifier(t *testing.T) {
+	ctx := context.Background()
+	db := newTrainingDB()
+	checker := NewLocal(db, Config{Thresholds: DefaultThresholds, MaxLinks: 2, DuplicateWindow: time.Hour})
+
+	spammy := &models.Comment{Content: "Cheap pills discount offer, order pills now"}
+	hammy := &models.Comment{Content: "Thanks for the thorough write-up on goroutine scheduling"}
+
+	before, err := checker.Check(ctx, spammy)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if before.Action != ActionPublish {
+		t.Fatalf("untrained checker held a comment without signals: %v", before)
+	}
+
+	for i := range minTraining {
+		spam := &models.Comment{ID: uint(i + 1), Content: fmt.Sprintf("Cheap pills discount offer number %d, order now", i)}
+		ham := &models.Comment{ID: uint(i + 101), Content: fmt.Sprintf("Thanks for the write-up on scheduling, part %d was thorough", i)}
+		if err := checker.Learn(ctx, spam, true); err != nil {
+			t.Fatalf("Learn spam: %v", err)
+		}
+		if err := checker.Learn(ctx, ham, false); err != nil {
+			t.Fatalf("Learn ham: %v", err)
+		}
+	}
+
+	after, err := checker.Check(ctx, spammy)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if after.Action == ActionPublish || after.Score <= before.Score {
+		t.Errorf("trained checker published spam: before %v, after %v", before, after)
+	}
+	if len(after.Reasons) == 0 || !strings.HasPrefix(after.Reasons[0], "looks like earlier spam") {
+		t.Errorf("verdict does not name the classifier: %v", after.Reasons)
+	}
+
+	ham, err := checker.Check(ctx, hammy)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if ham.Action != ActionPublish || ham.Score >= before.Score {
+		t.Errorf("trained checker did not clear ham: %v", ham)
+	}
+}
+
+func TestCheckIgnoresEditedCommentItself(t *testing.T) {
+	ctx := context.Background()
+	db := newTrainingDB()
+	checker := NewLocal(db, Config{Thresholds: DefaultThresholds, MaxLinks: 2, DuplicateWindow: time.Hour})
+
+	posted := models.Comment{ID: 7, Content: "Great post, thanks for sharing"}
+	db.comments = append(db.comments, posted)
+
+	for _, content := range []string{posted.Content, "  great POST,\n thanks for   sharing "} {
+		edited := posted
+		edited.Content = content
+		verdict, err := checker.Check(ctx, &edited)
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if verdict.Action != ActionPublish || len(verdict.Reasons) > 0 {
+			t.Errorf("editing a comment to %q counted it as its own duplicate: %v", content, verdict)
+		}
+	}
+
+	copied := models.Comment{ID: 8, Content: posted.Content}
+	verdict, err := checker.Check(ctx, &copied)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if verdict.Action == ActionPublish {
+		t.Errorf("copy of another comment was published: %v", verdict)
+	}
+}
+
+func TestTokenizeCapsLinkTokens(t *testing.T) {
+	long := "https://" + strings.Repeat("a", 40) + ".example.com/page"
+	tokens := Tokenize("See https://go.dev/doc and " + long)
+	for _, token := range tokens {
+		if len(token) > maxTokenLength {
+			t.Errorf("token %q is longer than %d", token, maxTokenLength)
+		}
+	}
+	found := false
+	for _, token := range tokens {
+		found = found || token == "link:go.dev"
+	}
+	if !found {
+		t.Errorf("short link host missing from %v", tokens)
+	}
+}
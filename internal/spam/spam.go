@@ -0,0 +1,110 @@
+// Package spam scores new comments for link spam and abuse, deciding whether they are
+// published, held for a moderator or rejected.
+package spam
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"obs/internal/database"
+	"obs/internal/models"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Action is what happens to a comment, decided by its spam score
+type Action string
+
+const (
+	ActionPublish Action = "publish"
+	ActionHold    Action = "hold"   // Held for a moderator
+	ActionReject  Action = "reject" // Stored as rejected, so a moderator can still approve it
+)
+
+// Verdict is the outcome of a spam check. Score runs from 0 for clean comments to 1 for
+// certain spam; Reasons name the signals that raised it.
+type Verdict struct {
+	Score   float64  `json:"score"`
+	Action  Action   `json:"action"`
+	Reasons []string `json:"reasons"`
+}
+
+// String describes the verdict for the moderation decision log
+func (v Verdict) String() string {
+	if len(v.Reasons) == 0 {
+		return fmt.Sprintf("Spam score %.2f", v.Score)
+	}
+	return fmt.Sprintf("Spam score %.2f: %s", v.Score, strings.Join(v.Reasons, ", "))
+}
+
+// SpamChecker scores comments before they are stored and learns from moderators
+type SpamChecker interface {
+	// Check scores a new comment
+	Check(ctx context.Context, comment *models.Comment) (Verdict, error)
+	// Learn trains the checker with a comment a moderator rejected as spam or approved
+	Learn(ctx context.Context, comment *models.Comment, spam bool) error
+}
+
+// Thresholds map scores to actions: comments scoring at least Hold are held for a
+// moderator, and those scoring at least Reject are rejected
+type Thresholds struct {
+	Hold   float64
+	Reject float64
+}
+
+// DefaultThresholds are used when no environment overrides are set
+var DefaultThresholds = Thresholds{Hold: 0.5, Reject: 0.9}
+
+// Action returns the action for a score
+func (t Thresholds) Action(score float64) Action {
+	switch {
+	case score >= t.Reject:
+		return ActionReject
+	case score >= t.Hold:
+		return ActionHold
+	default:
+		return ActionPublish
+	}
+}
+
+// New builds the checker selected by SPAM_CHECKER ("off" or "local", the default).
+// SPAM_HOLD_SCORE and SPAM_REJECT_SCORE override the thresholds, SPAM_MAX_LINKS the links
+// a comment may contain before it looks like link spam, and SPAM_BLOCKLIST adds comma
+// separated words, phrases and domains to the blocklist.
+func New(db database.Service) SpamChecker {
+	if strings.ToLower(os.Getenv("SPAM_CHECKER")) == "off" {
+		log.Println("[SPAM] Spam checking is disabled")
+		return Disabled{}
+	}
+
+	config := DefaultConfig
+	if v, err := strconv.ParseFloat(os.Getenv("SPAM_HOLD_SCORE"), 64); err == nil && v > 0 && v <= 1 {
+		config.Thresholds.Hold = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("SPAM_REJECT_SCORE"), 64); err == nil && v > 0 && v <= 1 {
+		config.Thresholds.Reject = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SPAM_MAX_LINKS")); err == nil && v >= 0 {
+		config.MaxLinks = v
+	}
+	for _, term := range strings.Split(os.Getenv("SPAM_BLOCKLIST"), ",") {
+		if term = strings.ToLower(strings.TrimSpace(term)); term != "" {
+			config.Blocklist = append(config.Blocklist, term)
+		}
+	}
+	return NewLocal(db, config)
+}
+
+// Disabled publishes every comment, for sites that rely on moderation alone
+type Disabled struct{}
+
+// Check publishes the comment
+func (Disabled) Check(context.Context, *models.Comment) (Verdict, error) {
+	return Verdict{Action: ActionPublish}, nil
+}
+
+// Learn does nothing
+func (Disabled) Learn(context.Context, *models.Comment, bool) error {
+	return nil
+}
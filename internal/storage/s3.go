@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unsignedPayload lets uploads stream without hashing the body first
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// maxPresignTTL is the longest validity S3 accepts for a presigned URL
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// S3Config describes an S3-compatible bucket
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // Address the bucket as endpoint/bucket instead of bucket.endpoint, as MinIO expects
+}
+
+// S3Storage stores objects in an S3-compatible bucket, signing requests with AWS Signature Version 4
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Storage creates a client for the configured bucket
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" || config.AccessKey == "" || config.SecretKey == "" {
+		return nil, errors.New("bucket, access key and secret key are required")
+	}
+	return &S3Storage{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, &Object{Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SignedURL returns a presigned GET URL, valid for at most seven days
+func (s *S3Storage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return s.presign(key, min(ttl, maxPresignTTL), time.Now().UTC())
+}
+
+// presign builds a query-string signed GET URL as of now
+func (s *S3Storage) presign(key string, ttl time.Duration, now time.Time) (string, error) {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.config.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	target.RawQuery = canonicalQuery(query)
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		target.EscapedPath(),
+		target.RawQuery,
+		"host:" + target.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	target.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonical)
+	return target.String(), nil
+}
+
+// newRequest builds a request for an object, to be signed by do
+func (s *S3Storage) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	return http.NewRequestWithContext(ctx, method, target.String(), body)
+}
+
+// do signs and sends a request, turning error responses into errors
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	s.sign(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("s3 %s %s returned %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 authorization header, signing the host, date and
+// payload hash headers
+func (s *S3Storage) sign(req *http.Request) {
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + unsignedPayload + "\n" +
+		"x-amz-date:" + req.Header.Get("X-Amz-Date") + "\n"
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		headers,
+		strings.Join(signed, ";"),
+		unsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, s.scope(now), strings.Join(signed, ";"), s.signature(now, canonical)))
+}
+
+// signature signs a canonical request with the key derived for the request's day
+func (s *S3Storage) signature(now time.Time, canonicalRequest string) string {
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + s.scope(now) + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// scope is the credential scope of requests signed at now
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// objectURL addresses an object path-style or virtual-hosted-style
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	if !ValidKey(key) {
+		return nil, fmt.Errorf("invalid object key %q", key)
+	}
+	target := *s.endpoint
+	if s.config.PathStyle {
+		target.Path = target.Path + "/" + s.config.Bucket + "/" + key
+	} else {
+		target.Host = s.config.Bucket + "." + target.Host
+		target.Path = target.Path + "/" + key
+	}
+	return &target, nil
+}
+
+// canonicalQuery encodes query parameters sorted by name, as Signature Version 4 requires
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but the RFC 3986 unreserved characters, which
+// Signature Version 4 leaves as they are
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
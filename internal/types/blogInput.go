@@ -0,0 +1,13 @@
+package types
+
+// BlogInput is the request body for creating and updating blogs
+type BlogInput struct {
+	Title   string `json:"title" binding:"required,min=3,max=225"`
+	Content string `json:"content" binding:"required,min=10"`
+	Status  string `json:"status"` // Only "draft" or "published" on create
+
+	// Tags replaces the blog's tags; omit it to keep them on update
+	Tags []string `json:"tags" binding:"omitempty,max=10,dive,min=1,max=50"`
+	// CategoryID moves the blog to a category, 0 removes it; omit it to keep it on update
+	CategoryID *uint `json:"category_id"`
+}
@@ -7,6 +7,16 @@ type Response struct {
 	Success    bool                     `json:"success"`
 	Message    string                   `json:"message,omitempty"`
 	Data       map[string]any           `json:"data,omitempty"`
+	Meta       *Meta                    `json:"meta,omitempty"`
 	Error      string                   `json:"error,omitempty"`
 	Blogs      map[string][]models.Blog `json:"messages,omitempty"`
 }
+
+// Meta describes a page of a list response. NextCursor is empty on the last page.
+type Meta struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	Order      string `json:"order"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
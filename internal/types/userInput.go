@@ -0,0 +1,9 @@
+package types
+
+// UserUpdateInput is the request body for users updating their own profile. Password,
+// role and verification have their own flows, so they cannot be set here.
+type UserUpdateInput struct {
+	Username string `json:"username" binding:"omitempty,min=3,max=100"`
+	Pfp      string `json:"pfp" binding:"omitempty,url"`
+	Email    string `json:"email" binding:"omitempty,email,max=100"` // Has to be verified again
+}
@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is how many unchanged lines surround each change in a unified diff
+const diffContextLines = 3
+
+// maxDiffEdits bounds the work spent on very different texts; past it the diff simply
+// replaces every changed line
+const maxDiffEdits = 2000
+
+// diffOp is one line of a diff: an unchanged, deleted or inserted line. oldLine and newLine
+// are the 0-based positions in each text before the line.
+type diffOp struct {
+	kind    byte // ' ', '-' or '+'
+	text    string
+	oldLine int
+	newLine int
+}
+
+// UnifiedDiff returns the line diff between two texts in unified diff format, or an
+// empty string when they are equal
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(ops); {
+		// Find the next change and the run of changes close enough to share its hunk
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			} else if i-last > 2*diffContextLines {
+				break
+			}
+		}
+
+		from := max(first-diffContextLines, start)
+		to := min(last+diffContextLines+1, len(ops))
+		writeHunk(&b, ops[from:to])
+		start = to
+	}
+	return b.String()
+}
+
+// writeHunk writes one @@ hunk
+func writeHunk(b *strings.Builder, ops []diffOp) {
+	oldCount, newCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	// An empty range is numbered after the line it follows
+	oldStart, newStart := ops[0].oldLine, ops[0].newLine
+	if oldCount > 0 {
+		oldStart++
+	}
+	if newCount > 0 {
+		newStart++
+	}
+
+	fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, op := range ops {
+		b.WriteByte(op.kind)
+		b.WriteString(op.text)
+		b.WriteByte('\n')
+	}
+}
+
+// splitLines splits text into lines, ignoring a trailing newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script between a and b with Myers' algorithm, the
+// same longest-common-subsequence diff used by git
+func diffLines(a, b []string) []diffOp {
+	// Common prefix and suffix are unchanged and need no search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{kind: ' ', text: a[i], oldLine: i, newLine: i})
+	}
+	for _, op := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		op.oldLine += prefix
+		op.newLine += prefix
+		ops = append(ops, op)
+	}
+	for i := suffix; i > 0; i-- {
+		ops = append(ops, diffOp{kind: ' ', text: a[len(a)-i], oldLine: len(a) - i, newLine: len(b) - i})
+	}
+	return ops
+}
+
+// myers finds the shortest edit script between a and b. trace keeps, for every edit
+// distance d, the furthest reaching x of each diagonal k in [-d-1, d+1], which is all the
+// backtracking needs.
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(a, b)
+	}
+
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		if d > maxDiffEdits {
+			return replaceAll(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // Move down: insert from b
+			} else {
+				x = v[offset+k-1] + 1 // Move right: delete from a
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// Walk back from the end through the recorded rounds
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{kind: ' ', text: a[x-1], oldLine: x - 1, newLine: y - 1})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{kind: '+', text: b[y-1], oldLine: x, newLine: y - 1})
+			} else {
+				ops = append(ops, diffOp{kind: '-', text: a[x-1], oldLine: x - 1, newLine: y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replaceAll is the edit script deleting every line of a and inserting every line of b
+func replaceAll(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i, line := range a {
+		ops = append(ops, diffOp{kind: '-', text: line, oldLine: i, newLine: 0})
+	}
+	for i, line := range b {
+		ops = append(ops, diffOp{kind: '+', text: line, oldLine: len(a), newLine: i})
+	}
+	return ops
+}
@@ -9,34 +9,120 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token lifetimes for the access JWT and the refresh token that renews it
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Token types, sent as the typ header of every token and required when it is parsed so
+// one kind of token cannot pass for another. Purpose tokens are typed after their purpose.
+const (
+	TokenTypeAccess    = "at+jwt"
+	TokenTypeOIDCState = "oidc-state+jwt"
+)
+
+// purposeTokenType returns the token type of purpose tokens for the given purpose
+func purposeTokenType(purpose string) string {
+	return purpose + "+jwt"
+}
+
 // CustomClaims defines the structure of JWT claims
 type CustomClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	SessionID uint   `json:"sid"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-// CreateJWT generates a new JWT token for a given user
-func CreateJWT(userID uint, username, email, role string) (string, error) {
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		return "", errors.New("JWT_SECRET is not set")
-	}
+// PurposeClaims defines the claims of short-lived, single-purpose tokens such as
+// email verification links. The purpose keeps one kind of token from being used as another.
+type PurposeClaims struct {
+	Purpose string `json:"purpose"`
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
 
+// CreateJWT generates a new short-lived access token for a given user session
+func CreateJWT(userID, sessionID uint, username, email, role string) (string, error) {
 	claims := CustomClaims{
-		UserID:   userID,
-		Username: username,
-		Email:    email,
-		Role:     role,
+		UserID:    userID,
+		SessionID: sessionID,
+		Username:  username,
+		Email:     email,
+		Role:      role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24 hours expiry
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	return SignClaims(TokenTypeAccess, claims)
+}
+
+// VerifyJWT verifies and extracts claims from a token
+func VerifyJWT(tokenString string) (*CustomClaims, error) {
+	claims := &CustomClaims{}
+	if err := ParseClaims(tokenString, TokenTypeAccess, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// CreatePurposeToken generates a signed token that is only valid for the given purpose
+func CreatePurposeToken(purpose string, userID uint, email string, ttl time.Duration) (string, error) {
+	claims := PurposeClaims{
+		Purpose: purpose,
+		UserID:  userID,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return SignClaims(purposeTokenType(purpose), claims)
+}
+
+// VerifyPurposeToken verifies a token created by CreatePurposeToken for the same purpose
+func VerifyPurposeToken(tokenString, purpose string) (*PurposeClaims, error) {
+	claims := &PurposeClaims{}
+	if err := ParseClaims(tokenString, purposeTokenType(purpose), claims); err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("invalid token purpose")
+	}
+	return claims, nil
+}
+
+// SignClaims signs the claims as a token of type typ with the active key of the key
+// ring, falling back to HS256 with JWT_SECRET when no asymmetric key is configured
+func SignClaims(typ string, claims jwt.Claims) (string, error) {
+	ring := loadedKeyRing()
+	if key := ring.Active(); key != nil {
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		token.Header["typ"] = typ
+
+		signedToken, err := token.SignedString(key.PrivateKey)
+		if err != nil {
+			return "", fmt.Errorf("error signing token: %w", err)
+		}
+		return signedToken, nil
+	}
+
+	if ring.Len() > 0 {
+		return "", errors.New("JWT_KEYS_DIR holds no private key to sign with")
+	}
+	secretKey := os.Getenv("JWT_SECRET")
+	if secretKey == "" {
+		return "", errors.New("neither JWT_KEYS_DIR nor JWT_SECRET is set")
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["typ"] = typ
 
 	signedToken, err := token.SignedString([]byte(secretKey))
 	if err != nil {
@@ -46,27 +132,48 @@ func CreateJWT(userID uint, username, email, role string) (string, error) {
 	return signedToken, nil
 }
 
-// VerifyJWT verifies and extracts claims from a token
-func VerifyJWT(tokenString string) (*CustomClaims, error) {
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		return nil, errors.New("JWT_SECRET is not set")
-	}
+// ParseClaims verifies the token signature and type and decodes it into claims. Tokens
+// with a kid are checked against that key of the ring, so tokens signed by a rotated-out
+// key stay valid while it is kept around. Tokens without a kid are checked with
+// JWT_SECRET, but only while the ring holds no keys.
+func ParseClaims(tokenString, typ string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		if t.Header["typ"] != typ {
+			return nil, fmt.Errorf("unexpected token type: %v", t.Header["typ"])
+		}
+
+		ring := loadedKeyRing()
+		if kid, ok := t.Header["kid"].(string); ok {
+			key, found := ring.Key(kid)
+			if !found {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+			if t.Method.Alg() != key.Method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			}
+			return key.PublicKey, nil
+		}
 
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(t *jwt.Token) (any, error) {
+		if ring.Len() > 0 {
+			return nil, errors.New("tokens without a key ID are not accepted once JWT keys are configured")
+		}
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
+		secretKey := os.Getenv("JWT_SECRET")
+		if secretKey == "" {
+			return nil, errors.New("JWT_SECRET is not set")
+		}
 		return []byte(secretKey), nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error parsing token: %w", err)
+		return fmt.Errorf("error parsing token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		return claims, nil
+	if !token.Valid {
+		return errors.New("invalid token")
 	}
 
-	return nil, errors.New("invalid token")
+	return nil
 }
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is an asymmetric key used to sign or verify JWTs. Keys loaded from
+// a public key file can only verify, which lets retired keys outlive their private half.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	ModTime    time.Time
+}
+
+// KeyRing holds every key tokens may be verified with and the one new tokens are signed with
+type KeyRing struct {
+	keys   map[string]*SigningKey
+	active *SigningKey
+}
+
+// JWK is the public half of a signing key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// keyRingCheckInterval is how often JWT_KEYS_DIR is checked for added, changed or
+// removed keys
+const keyRingCheckInterval = time.Minute
+
+// keyRing caches the ring read from JWT_KEYS_DIR along with a fingerprint of the files
+// it was read from
+var keyRing struct {
+	mu        sync.Mutex
+	ring      *KeyRing
+	files     string
+	checkedAt time.Time
+}
+
+// loadedKeyRing returns the ring read from JWT_KEYS_DIR, reading it again when its files
+// changed so keys can be rotated without a restart. A ring that fails to load on startup
+// is fatal; later failures keep the keys already loaded.
+func loadedKeyRing() *KeyRing {
+	keyRing.mu.Lock()
+	defer keyRing.mu.Unlock()
+
+	if keyRing.ring != nil && time.Since(keyRing.checkedAt) < keyRingCheckInterval {
+		return keyRing.ring
+	}
+	keyRing.checkedAt = time.Now()
+
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if keyRing.ring == nil {
+			keyRing.ring = &KeyRing{keys: map[string]*SigningKey{}}
+		}
+		return keyRing.ring
+	}
+
+	files, err := keyFiles(dir)
+	if err == nil && keyRing.ring != nil && files == keyRing.files {
+		return keyRing.ring
+	}
+
+	ring, err := LoadKeyRing(dir, os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		if keyRing.ring == nil {
+			log.Fatalf("[AUTH] ❌ Failed to load JWT keys from %s: %v", dir, err)
+		}
+		log.Printf("[AUTH] Failed to reload JWT keys from %s, keeping the loaded keys: %v", dir, err)
+		return keyRing.ring
+	}
+	if ring.active != nil {
+		log.Printf("[AUTH] Signing JWTs with %s key %q (%d keys loaded)", ring.active.Method.Alg(), ring.active.ID, len(ring.keys))
+	}
+	keyRing.ring, keyRing.files = ring, files
+	return ring
+}
+
+// keyFiles fingerprints the key files in dir by name, size and modification time
+func keyFiles(dir string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return "", err
+	}
+	var files strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&files, "%s:%d:%d\n", filepath.Base(path), info.Size(), info.ModTime().UnixNano())
+	}
+	return files.String(), nil
+}
+
+// LoadKeyRing reads every .pem file in dir as a key named after the file (without
+// extension). RSA keys sign with RS256 and Ed25519 keys with EdDSA. The active key is
+// activeKID if set, otherwise the most recently modified private key.
+func LoadKeyRing(dir, activeKID string) (*KeyRing, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &KeyRing{keys: make(map[string]*SigningKey, len(paths))}
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		ring.keys[key.ID] = key
+	}
+
+	if activeKID != "" {
+		key, ok := ring.keys[activeKID]
+		if !ok {
+			return nil, fmt.Errorf("active key %q not found", activeKID)
+		}
+		if key.PrivateKey == nil {
+			return nil, fmt.Errorf("active key %q has no private key", activeKID)
+		}
+		ring.active = key
+		return ring, nil
+	}
+
+	for _, key := range ring.keys {
+		if key.PrivateKey != nil && (ring.active == nil || key.ModTime.After(ring.active.ModTime)) {
+			ring.active = key
+		}
+	}
+	return ring, nil
+}
+
+// loadSigningKey parses a PEM encoded private or public key
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), ModTime: info.ModTime()}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", parsed)
+	}
+	return key, nil
+}
+
+// Active returns the key new tokens are signed with, or nil when none is configured
+func (r *KeyRing) Active() *SigningKey {
+	return r.active
+}
+
+// Len returns the number of keys in the ring
+func (r *KeyRing) Len() int {
+	return len(r.keys)
+}
+
+// Key returns the key with the given ID
+func (r *KeyRing) Key(kid string) (*SigningKey, bool) {
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+// JWKS returns the public keys of the ring, sorted by key ID
+func (r *KeyRing) JWKS() []JWK {
+	jwks := make([]JWK, 0, len(r.keys))
+	for _, key := range r.keys {
+		jwk := JWK{Use: "sig", Alg: key.Method.Alg(), Kid: key.ID}
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
+
+// PublicJWKS returns the public keys tokens issued by this server can be verified with
+func PublicJWKS() []JWK {
+	return loadedKeyRing().JWKS()
+}
@@ -1,16 +1,23 @@
 package utils
 
-import "obs/internal/models"
+import (
+	"obs/internal/models"
+	"time"
+)
 
 type SanitizedUser struct {
-	ID        uint   `json:"id"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	Pfp       string `json:"pfp"`
-	Role      string `json:"role"`
-	CreatedAt string `json:"created_at"`
-	Followers []uint `json:"followers"` // List of follower IDs
-	Following []uint `json:"following"` // List of following IDs
+	ID               uint              `json:"id"`
+	Username         string            `json:"username"`
+	Email            string            `json:"email"`
+	Pfp              models.Renditions `json:"pfp"` // Avatar rendition name, e.g. "64", to URL
+	Role             string            `json:"role"`
+	EmailVerified    bool              `json:"email_verified"`
+	TwoFactorEnabled bool              `json:"two_factor_enabled"`
+	CreatedAt        string            `json:"created_at"`
+	FollowersCount   int64             `json:"followers_count"`
+	FollowingCount   int64             `json:"following_count"`
+	Followers        []uint            `json:"followers"` // List of follower IDs
+	Following        []uint            `json:"following"` // List of following IDs
 }
 
 func SanitizedUserData(user *models.User) SanitizedUser {
@@ -29,13 +36,81 @@ func SanitizedUserData(user *models.User) SanitizedUser {
 	}
 
 	return SanitizedUser{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		Pfp:       user.Pfp,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt.Format("2006-01-02 15:04:05"),
-		Followers: followers,
-		Following: following,
+		ID:               user.ID,
+		Username:         user.Username,
+		Email:            user.Email,
+		Pfp:              pfpURLs(user),
+		Role:             user.Role,
+		EmailVerified:    user.IsEmailVerified(),
+		TwoFactorEnabled: user.IsTwoFactorEnabled(),
+		CreatedAt:        user.CreatedAt.Format("2006-01-02 15:04:05"),
+		FollowersCount:   user.FollowersCount,
+		FollowingCount:   user.FollowingCount,
+		Followers:        followers,
+		Following:        following,
+	}
+}
+
+// pfpURLs returns the renditions of the user's uploaded avatar, or the profile picture
+// URL as the only "original" rendition when it was not uploaded
+func pfpURLs(user *models.User) models.Renditions {
+	if len(user.PfpRenditions) > 0 {
+		return user.PfpRenditions
+	}
+	return models.Renditions{"original": user.Pfp}
+}
+
+type SanitizedSession struct {
+	ID         uint   `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+func SanitizedSessionData(session *models.Session) SanitizedSession {
+	return SanitizedSession{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt.Format("2006-01-02 15:04:05"),
+		LastSeenAt: session.LastSeenAt.Format("2006-01-02 15:04:05"),
+		ExpiresAt:  session.ExpiresAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// SanitizedOwnSession is a session listed to its own user
+type SanitizedOwnSession struct {
+	SanitizedSession
+	Current bool `json:"current"` // Whether this is the session making the request
+}
+
+func SanitizedOwnSessionData(session *models.Session, currentID uint) SanitizedOwnSession {
+	return SanitizedOwnSession{
+		SanitizedSession: SanitizedSessionData(session),
+		Current:          session.ID == currentID,
+	}
+}
+
+type SanitizedAccessToken struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+func SanitizedAccessTokenData(token *models.PersonalAccessToken) SanitizedAccessToken {
+	return SanitizedAccessToken{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.ScopeList(),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
 }
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxSlugLength leaves room for a collision suffix within the 255 character column. It
+// counts bytes, so a slug of it also fits a column that long in characters.
+const maxSlugLength = 80
+
+// FallbackSlug is used for titles without any letters or digits
+const FallbackSlug = "post"
+
+// transliterations covers letters that do not decompose into an ASCII base letter
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "ae", 'œ': "oe", 'Œ': "oe", 'ø': "o", 'Ø': "o",
+	'đ': "d", 'Đ': "d", 'ð': "d", 'Ð': "d", 'þ': "th", 'Þ': "th", 'ł': "l", 'Ł': "l",
+	'ı': "i", 'ħ': "h", 'Ħ': "h", '&': " and ",
+
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g",
+
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o",
+}
+
+// Slugify turns a title into a lowercase, hyphen separated slug. Accents are stripped
+// from Latin letters and Greek and Cyrillic are transliterated to ASCII; letters of other
+// scripts, such as CJK, Hangul or Arabic, are kept, to be percent-encoded in URLs.
+func Slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+	keepMarks := false // Whether the combining marks that follow belong to a kept letter
+	for _, r := range norm.NFC.String(strings.ToLower(title)) {
+		if t, ok := transliterations[r]; ok {
+			hyphen = writeSlugString(&b, t, hyphen)
+			keepMarks = false
+			continue
+		}
+		// Decompose accented letters to drop their combining marks, e.g. "é" becomes "e"
+		for _, d := range norm.NFD.String(string(r)) {
+			if unicode.Is(unicode.M, d) {
+				// Scripts that are not transliterated need their marks, such as Devanagari
+				// vowel signs
+				if keepMarks {
+					b.WriteRune(d)
+				}
+				continue
+			}
+			if t, ok := transliterations[d]; ok {
+				hyphen = writeSlugString(&b, t, hyphen)
+				keepMarks = false
+				continue
+			}
+			hyphen = writeSlugRune(&b, d, hyphen)
+			keepMarks = !hyphen && d > unicode.MaxASCII && !unicode.In(d, unicode.Latin, unicode.Greek, unicode.Cyrillic)
+		}
+	}
+
+	// Recompose what is left, e.g. Hangul syllables
+	slug := norm.NFC.String(strings.Trim(b.String(), "-"))
+	if len(slug) > maxSlugLength {
+		cut := maxSlugLength
+		for !utf8.RuneStart(slug[cut]) {
+			cut--
+		}
+		slug = slug[:cut]
+		// Prefer cutting at a word boundary
+		if i := strings.LastIndexByte(slug, '-'); i > maxSlugLength/2 {
+			slug = slug[:i]
+		}
+		slug = strings.Trim(slug, "-")
+	}
+	if slug == "" {
+		return FallbackSlug
+	}
+	return slug
+}
+
+// TopicSlug makes the slug of a tag or category name. Short names are often programming
+// languages, so a "+" or "#" following a letter, digit or another "+" is spelled out,
+// keeping "C", "C++" and "C#" apart.
+func TopicSlug(name string) string {
+	var b strings.Builder
+	var prev rune
+	for _, r := range name {
+		switch {
+		case r == '+' && (prev == '+' || unicode.IsLetter(prev) || unicode.IsDigit(prev)):
+			b.WriteString(" plus ")
+		case r == '#' && (unicode.IsLetter(prev) || unicode.IsDigit(prev)):
+			b.WriteString(" sharp ")
+		default:
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return Slugify(b.String())
+}
+
+// writeSlugRune appends a letter or digit, or a single hyphen for any run of other
+// characters, and reports whether the output now ends in a hyphen
+func writeSlugRune(b *strings.Builder, r rune, hyphen bool) bool {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) {
+		b.WriteRune(r)
+		return false
+	}
+	if !hyphen && b.Len() > 0 {
+		b.WriteByte('-')
+	}
+	return true
+}
+
+// writeSlugString appends each rune of a transliteration as writeSlugRune does
+func writeSlugString(b *strings.Builder, s string, hyphen bool) bool {
+	for _, r := range s {
+		hyphen = writeSlugRune(b, r, hyphen)
+	}
+	return hyphen
+}
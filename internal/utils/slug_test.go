@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Leading and trailing  ", "leading-and-trailing"},
+		{"Crème brûlée à la carte", "creme-brulee-a-la-carte"},
+		{"Straße & Ærø", "strasse-and-aero"},
+		{"Привет, мир", "privet-mir"},
+		{"Ёлка и йогурт", "yolka-i-yogurt"},
+		{"Καλημέρα κόσμε", "kalimera-kosme"},
+		{"Go 1.23 release notes", "go-1-23-release-notes"},
+		{"中文博客", "中文博客"},
+		{"日本語 の タイトル", "日本語-の-タイトル"},
+		{"한국어 제목", "한국어-제목"},
+		{"مرحبا بالعالم", "مرحبا-بالعالم"},
+		{"שלום עולם", "שלום-עולם"},
+		{"नमस्ते दुनिया", "नमस्ते-दुनिया"},
+		{"Rust vs 中文", "rust-vs-中文"},
+		{"!!!", FallbackSlug},
+		{"", FallbackSlug},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.title); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSlugifyTruncates(t *testing.T) {
+	long := Slugify(strings.Repeat("word ", 40))
+	if len(long) > maxSlugLength || strings.HasSuffix(long, "-") || strings.HasSuffix(long, "wor") {
+		t.Errorf("long title became %q", long)
+	}
+
+	// Multi-byte letters are never cut in half
+	cjk := Slugify(strings.Repeat("中", 60))
+	if len(cjk) > maxSlugLength || !utf8.ValidString(cjk) {
+		t.Errorf("long CJK title became %q", cjk)
+	}
+}
+
+func TestTopicSlug(t *testing.T) {
+	tests := map[string]string{
+		"C":       "c",
+		"C++":     "c-plus-plus",
+		"C#":      "c-sharp",
+		"F#":      "f-sharp",
+		"g++":     "g-plus-plus",
+		"#golang": "golang",
+		"1+1":     "1-plus-1",
+		"中文":      "中文",
+		"日本語":     "日本語",
+		"한국어":     "한국어",
+		"Go":      "go",
+	}
+	for name, want := range tests {
+		if got := TopicSlug(name); got != want {
+			t.Errorf("TopicSlug(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
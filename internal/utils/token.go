@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateToken returns a URL-safe random token built from n random bytes
+func GenerateToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of a token for storage at rest
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalAccessTokenPrefix marks a bearer token as a personal access token rather than a JWT
+const PersonalAccessTokenPrefix = "obs_pat_"
+
+// GeneratePersonalAccessToken returns a new personal access token and the short prefix shown in listings
+func GeneratePersonalAccessToken() (token, prefix string, err error) {
+	secret, err := GenerateToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	token = PersonalAccessTokenPrefix + secret
+	return token, token[:len(PersonalAccessTokenPrefix)+4], nil
+}